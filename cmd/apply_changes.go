@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ApplyChangesCmd holds the cmd flags
+type ApplyChangesCmd struct{}
+
+// NewApplyChangesCmd defines a command
+func NewApplyChangesCmd() *cobra.Command {
+	cmd := &ApplyChangesCmd{}
+	applyChangesCmd := &cobra.Command{
+		Use:    "apply-changes CHANGES TARGET",
+		Short:  "Apply exported changes to a rootfs",
+		Hidden: true,
+		Args:   cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), args[0], args[1], log.Default)
+		},
+	}
+
+	return applyChangesCmd
+}
+
+// Run runs the command logic, this is expected to be executed
+// inside the container's user namespace
+func (cmd *ApplyChangesCmd) Run(ctx context.Context, changes, target string, log log.Logger) error {
+	return dockerless.ApplyChanges(changes, target, log)
+}
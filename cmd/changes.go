@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/spf13/cobra"
+)
+
+// ChangesCmd holds the cmd flags
+type ChangesCmd struct {
+	Base  string
+	Lower []string
+}
+
+// NewChangesCmd defines a command
+func NewChangesCmd() *cobra.Command {
+	cmd := &ChangesCmd{}
+	changesCmd := &cobra.Command{
+		Use:    "changes DIR",
+		Short:  "List the changes of a rootfs or overlayfs upper directory",
+		Hidden: true,
+		Args:   cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), args[0])
+		},
+	}
+
+	changesCmd.Flags().StringVar(&cmd.Base, "base", "", "Rootfs DIR is compared to, when DIR is a full rootfs")
+	changesCmd.Flags().StringArrayVar(&cmd.Lower, "lower", []string{}, "Lower directory of the overlayfs DIR is the upper directory of, the topmost first")
+
+	return changesCmd
+}
+
+// Run runs the command logic, this is expected to be executed
+// inside the container's user namespace
+func (cmd *ChangesCmd) Run(ctx context.Context, dir string) error {
+	var changes []dockerless.Change
+	var err error
+
+	if cmd.Base != "" {
+		changes, err = dockerless.TreeChanges(cmd.Base, dir)
+	} else {
+		changes, err = dockerless.ListChanges(dir, cmd.Lower)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	out, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+
+	return nil
+}
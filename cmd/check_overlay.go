@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/spf13/cobra"
+)
+
+// CheckOverlayCmd holds the cmd flags
+type CheckOverlayCmd struct{}
+
+// NewCheckOverlayCmd defines a command
+func NewCheckOverlayCmd() *cobra.Command {
+	cmd := &CheckOverlayCmd{}
+	checkOverlayCmd := &cobra.Command{
+		Use:    "check-overlay DIR",
+		Short:  "Check that an overlayfs rootfs can be mounted",
+		Hidden: true,
+		Args:   cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), args[0])
+		},
+	}
+
+	return checkOverlayCmd
+}
+
+// Run runs the command logic, this is expected to be executed
+// inside the container's user namespace
+func (cmd *CheckOverlayCmd) Run(ctx context.Context, dir string) error {
+	return dockerless.CheckOverlay(dir)
+}
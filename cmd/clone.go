@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// CloneCmd holds the cmd flags
+type CloneCmd struct{}
+
+// NewCloneCmd defines a command
+func NewCloneCmd() *cobra.Command {
+	cmd := &CloneCmd{}
+	cloneCmd := &cobra.Command{
+		Use:    "clone SOURCE TARGET",
+		Short:  "Clone a rootfs",
+		Hidden: true,
+		Args:   cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), args[0], args[1], log.Default)
+		},
+	}
+
+	return cloneCmd
+}
+
+// Run runs the command logic, this is expected to be executed
+// inside the container's user namespace
+func (cmd *CloneCmd) Run(ctx context.Context, source, target string, log log.Logger) error {
+	return dockerless.CloneTree(source, target, log)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// CommitCmd holds the cmd flags
+type CommitCmd struct {
+	Message string
+	Author  string
+}
+
+// NewCommitCmd defines a command
+func NewCommitCmd() *cobra.Command {
+	cmd := &CommitCmd{}
+	commitCmd := &cobra.Command{
+		Use:   "commit WORKSPACE IMAGE",
+		Short: "Create a local image from the changes of a workspace",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args[0], args[1], log.Default)
+		},
+	}
+
+	commitCmd.Flags().StringVarP(&cmd.Message, "message", "m", "", "Commit message, recorded in the image history")
+	commitCmd.Flags().StringVarP(&cmd.Author, "author", "a", "", "Author of the image")
+
+	return commitCmd
+}
+
+// Run runs the command logic
+func (cmd *CommitCmd) Run(ctx context.Context, options *options.Options, workspaceId, image string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	digest, err := dockerlessProvider.Commit(ctx, workspaceId, image, cmd.Message, cmd.Author)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(digest.String())
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/spf13/cobra"
+)
+
+// ConflictsCmd holds the cmd flags
+type ConflictsCmd struct {
+	Old      []string
+	New      []string
+	Exported bool
+}
+
+// NewConflictsCmd defines a command
+func NewConflictsCmd() *cobra.Command {
+	cmd := &ConflictsCmd{}
+	conflictsCmd := &cobra.Command{
+		Use:    "conflicts CHANGES",
+		Short:  "List the changes that differ between two images",
+		Hidden: true,
+		Args:   cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), args[0])
+		},
+	}
+
+	conflictsCmd.Flags().StringArrayVar(&cmd.Old, "old", []string{}, "Lower directory of the old image, the topmost first")
+	conflictsCmd.Flags().StringArrayVar(&cmd.New, "new", []string{}, "Lower directory of the new image, the topmost first")
+	conflictsCmd.Flags().BoolVar(&cmd.Exported, "exported", false, "The changes were written by export-changes")
+
+	return conflictsCmd
+}
+
+// Run runs the command logic, this is expected to be executed
+// inside the container's user namespace
+func (cmd *ConflictsCmd) Run(ctx context.Context, changes string) error {
+	conflicts, err := dockerless.Conflicts(changes, cmd.Exported, cmd.Old, cmd.New)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.Marshal(conflicts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// DiffCmd holds the cmd flags
+type DiffCmd struct {
+	JSON bool
+}
+
+// NewDiffCmd defines a command
+func NewDiffCmd() *cobra.Command {
+	cmd := &DiffCmd{}
+	diffCmd := &cobra.Command{
+		Use:   "diff WORKSPACE",
+		Short: "List the files of a workspace added, changed or deleted since its image",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args[0], log.Default)
+		},
+	}
+
+	diffCmd.Flags().BoolVar(&cmd.JSON, "json", false, "Print changes as JSON")
+
+	return diffCmd
+}
+
+// Run runs the command logic
+func (cmd *DiffCmd) Run(ctx context.Context, options *options.Options, workspaceId string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	changes, err := dockerlessProvider.Diff(ctx, workspaceId)
+	if err != nil {
+		return err
+	}
+
+	if cmd.JSON {
+		out, err := json.Marshal(changes)
+		if err != nil {
+			return fmt.Errorf("error marshalling changes: %w", err)
+		}
+
+		fmt.Println(string(out))
+
+		return nil
+	}
+
+	for _, change := range changes {
+		fmt.Printf("%s %s\n", change.Kind, change.Path)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ExportChangesCmd holds the cmd flags
+type ExportChangesCmd struct{}
+
+// NewExportChangesCmd defines a command
+func NewExportChangesCmd() *cobra.Command {
+	cmd := &ExportChangesCmd{}
+	exportChangesCmd := &cobra.Command{
+		Use:    "export-changes BASE ROOTFS TARGET",
+		Short:  "Export the changes of a rootfs against its base",
+		Hidden: true,
+		Args:   cobra.ExactArgs(3),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), args[0], args[1], args[2], log.Default)
+		},
+	}
+
+	return exportChangesCmd
+}
+
+// Run runs the command logic, this is expected to be executed
+// inside the container's user namespace
+func (cmd *ExportChangesCmd) Run(ctx context.Context, base, rootfs, target string, log log.Logger) error {
+	return dockerless.ExportChanges(base, rootfs, target, log)
+}
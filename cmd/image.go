@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// NewImageCmd defines the image management commands
+func NewImageCmd() *cobra.Command {
+	imageCmd := &cobra.Command{
+		Use:   "image",
+		Short: "Manage images",
+	}
+
+	imageCmd.AddCommand(NewImageInspectCmd())
+	imageCmd.AddCommand(NewImagePruneCmd())
+	imageCmd.AddCommand(NewImageSaveCmd())
+
+	return imageCmd
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ImageInspectCmd holds the cmd flags
+type ImageInspectCmd struct{}
+
+// NewImageInspectCmd defines a command
+func NewImageInspectCmd() *cobra.Command {
+	cmd := &ImageInspectCmd{}
+	imageInspectCmd := &cobra.Command{
+		Use:   "inspect IMAGE...",
+		Short: "Print the manifest, config and layer history of stored images as JSON",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args, log.Default)
+		},
+	}
+
+	return imageInspectCmd
+}
+
+// Run runs the command logic
+func (cmd *ImageInspectCmd) Run(ctx context.Context, options *options.Options, images []string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	inspected := []*dockerless.ImageInspect{}
+
+	for _, image := range images {
+		imageInspect, err := dockerlessProvider.InspectImage(image)
+		if err != nil {
+			return err
+		}
+
+		inspected = append(inspected, imageInspect)
+	}
+
+	out, err := json.MarshalIndent(inspected, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling images: %w", err)
+	}
+
+	fmt.Println(string(out))
+
+	return nil
+}
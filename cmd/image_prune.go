@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ImagePruneCmd holds the cmd flags
+type ImagePruneCmd struct {
+	DryRun bool
+	All    bool
+}
+
+// NewImagePruneCmd defines a command
+func NewImagePruneCmd() *cobra.Command {
+	cmd := &ImagePruneCmd{}
+	imagePruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove images not used by any workspace",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, log.Default)
+		},
+	}
+
+	imagePruneCmd.Flags().BoolVar(&cmd.DryRun, "dry-run", false, "Only report what would be removed")
+	imagePruneCmd.Flags().BoolVarP(&cmd.All, "all", "a", false, "Remove all images not used by a workspace, not just dangling ones")
+
+	return imagePruneCmd
+}
+
+// Run runs the command logic
+func (cmd *ImagePruneCmd) Run(ctx context.Context, options *options.Options, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	return dockerlessProvider.PruneImages(ctx, cmd.DryRun, cmd.All)
+}
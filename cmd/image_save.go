@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ImageSaveCmd holds the cmd flags
+type ImageSaveCmd struct {
+	Output string
+	Format string
+}
+
+// NewImageSaveCmd defines a command
+func NewImageSaveCmd() *cobra.Command {
+	cmd := &ImageSaveCmd{}
+	imageSaveCmd := &cobra.Command{
+		Use:   "save IMAGE...",
+		Short: "Save stored images to a docker-archive tarball or an OCI image layout",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args, log.Default)
+		},
+	}
+
+	imageSaveCmd.Flags().StringVarP(&cmd.Output, "output", "o", "", "Path of the tarball or of the OCI image layout directory to write")
+	imageSaveCmd.Flags().StringVar(&cmd.Format, "format", dockerless.SaveFormatDockerArchive, "Format to save images in, docker-archive or oci")
+	_ = imageSaveCmd.MarkFlagRequired("output")
+
+	return imageSaveCmd
+}
+
+// Run runs the command logic
+func (cmd *ImageSaveCmd) Run(ctx context.Context, options *options.Options, images []string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	return dockerlessProvider.SaveImages(ctx, images, cmd.Format, cmd.Output)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ImagesCmd holds the cmd flags
+type ImagesCmd struct {
+	JSON bool
+}
+
+// NewImagesCmd defines a command
+func NewImagesCmd() *cobra.Command {
+	cmd := &ImagesCmd{}
+	imagesCmd := &cobra.Command{
+		Use:   "images",
+		Short: "List stored images",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, log.Default)
+		},
+	}
+
+	imagesCmd.Flags().BoolVar(&cmd.JSON, "json", false, "Print images as JSON")
+
+	return imagesCmd
+}
+
+// Run runs the command logic
+func (cmd *ImagesCmd) Run(ctx context.Context, options *options.Options, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	summaries, err := dockerlessProvider.ImageSummaries()
+	if err != nil {
+		return err
+	}
+
+	if cmd.JSON {
+		out, err := json.Marshal(summaries)
+		if err != nil {
+			return fmt.Errorf("error marshalling images: %w", err)
+		}
+
+		fmt.Println(string(out))
+
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(writer, "REPOSITORY\tTAG\tDIGEST\tCREATED\tSIZE")
+
+	for _, summary := range summaries {
+		repository, tag := summary.Name, "<none>"
+
+		ref, err := name.ParseReference(summary.Name)
+		if err == nil {
+			repository, tag = ref.Context().Name(), ref.Identifier()
+		}
+
+		created := "N/A"
+		if !summary.Created.IsZero() {
+			created = units.HumanDuration(time.Since(summary.Created)) + " ago"
+		}
+
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s\t%s\n",
+			repository,
+			tag,
+			shortDigest(summary.Digest),
+			created,
+			units.HumanSize(float64(summary.Size)),
+		)
+	}
+
+	return writer.Flush()
+}
+
+// shortDigest returns the first 12 characters of the hex part of input digest.
+func shortDigest(digest string) string {
+	_, hex, found := strings.Cut(digest, ":")
+	if !found || len(hex) < 12 {
+		return digest
+	}
+
+	return hex[:12]
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// LoginCmd holds the cmd flags
+type LoginCmd struct {
+	Username      string
+	Password      string
+	PasswordStdin bool
+}
+
+// NewLoginCmd defines a command
+func NewLoginCmd() *cobra.Command {
+	cmd := &LoginCmd{}
+	loginCmd := &cobra.Command{
+		Use:   "login REGISTRY",
+		Short: "Log in to a registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args[0], log.Default)
+		},
+	}
+
+	loginCmd.Flags().StringVarP(&cmd.Username, "username", "u", "", "Username")
+	loginCmd.Flags().StringVarP(&cmd.Password, "password", "p", "", "Password")
+	loginCmd.Flags().BoolVar(&cmd.PasswordStdin, "password-stdin", false, "Take the password from stdin")
+
+	return loginCmd
+}
+
+// Run runs the command logic
+func (cmd *LoginCmd) Run(ctx context.Context, options *options.Options, registry string, log log.Logger) error {
+	if cmd.PasswordStdin {
+		password, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		cmd.Password = strings.TrimRight(string(password), "\r\n")
+	}
+
+	if cmd.Username == "" || cmd.Password == "" {
+		return fmt.Errorf("username and password are required")
+	}
+
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	return dockerlessProvider.Login(registry, cmd.Username, cmd.Password)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// LogoutCmd holds the cmd flags
+type LogoutCmd struct{}
+
+// NewLogoutCmd defines a command
+func NewLogoutCmd() *cobra.Command {
+	cmd := &LogoutCmd{}
+	logoutCmd := &cobra.Command{
+		Use:   "logout REGISTRY",
+		Short: "Log out from a registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args[0], log.Default)
+		},
+	}
+
+	return logoutCmd
+}
+
+// Run runs the command logic
+func (cmd *LogoutCmd) Run(ctx context.Context, options *options.Options, registry string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	return dockerlessProvider.Logout(registry)
+}
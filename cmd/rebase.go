@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// RebaseCmd holds the cmd flags
+type RebaseCmd struct {
+	Force bool
+}
+
+// NewRebaseCmd defines a command
+func NewRebaseCmd() *cobra.Command {
+	cmd := &RebaseCmd{}
+	rebaseCmd := &cobra.Command{
+		Use:   "rebase WORKSPACE [IMAGE]",
+		Short: "Move a workspace to a newer image, keeping its changes",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			image := ""
+			if len(args) > 1 {
+				image = args[1]
+			}
+
+			return cmd.Run(context.Background(), options, args[0], image, log.Default)
+		},
+	}
+
+	rebaseCmd.Flags().BoolVarP(&cmd.Force, "force", "f", false, "Keep the workspace's version of the paths the image changed as well")
+
+	return rebaseCmd
+}
+
+// Run runs the command logic
+func (cmd *RebaseCmd) Run(ctx context.Context, options *options.Options, workspaceId, image string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	return dockerlessProvider.Rebase(ctx, workspaceId, image, cmd.Force)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ResetCmd holds the cmd flags
+type ResetCmd struct{}
+
+// NewResetCmd defines a command
+func NewResetCmd() *cobra.Command {
+	cmd := &ResetCmd{}
+	resetCmd := &cobra.Command{
+		Use:   "reset WORKSPACE",
+		Short: "Rebuild the rootfs of a workspace from its image, keeping its volumes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args[0], log.Default)
+		},
+	}
+
+	return resetCmd
+}
+
+// Run runs the command logic
+func (cmd *ResetCmd) Run(ctx context.Context, options *options.Options, workspaceId string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	return dockerlessProvider.Reset(ctx, workspaceId)
+}
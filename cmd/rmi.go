@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// RmiCmd holds the cmd flags
+type RmiCmd struct {
+	Force bool
+}
+
+// NewRmiCmd defines a command
+func NewRmiCmd() *cobra.Command {
+	cmd := &RmiCmd{}
+	rmiCmd := &cobra.Command{
+		Use:   "rmi IMAGE...",
+		Short: "Remove stored images",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args, log.Default)
+		},
+	}
+
+	rmiCmd.Flags().BoolVarP(&cmd.Force, "force", "f", false, "Remove images even if used by a workspace")
+
+	return rmiCmd
+}
+
+// Run runs the command logic
+func (cmd *RmiCmd) Run(ctx context.Context, options *options.Options, images []string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		err = dockerlessProvider.RemoveImage(image, cmd.Force)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -67,5 +67,24 @@ func BuildRoot() *cobra.Command {
 	rootCmd.AddCommand(NewCommandCmd())
 	rootCmd.AddCommand(NewStopCmd())
 	rootCmd.AddCommand(NewTargetArchitectureCmd())
+	rootCmd.AddCommand(NewLoginCmd())
+	rootCmd.AddCommand(NewLogoutCmd())
+	rootCmd.AddCommand(NewImageCmd())
+	rootCmd.AddCommand(NewImagesCmd())
+	rootCmd.AddCommand(NewRmiCmd())
+	rootCmd.AddCommand(NewTagCmd())
+	rootCmd.AddCommand(NewSnapshotCmd())
+	rootCmd.AddCommand(NewResetCmd())
+	rootCmd.AddCommand(NewRebaseCmd())
+	rootCmd.AddCommand(NewDiffCmd())
+	rootCmd.AddCommand(NewCommitCmd())
+	rootCmd.AddCommand(NewUnpackCmd())
+	rootCmd.AddCommand(NewCheckOverlayCmd())
+	rootCmd.AddCommand(NewCloneCmd())
+	rootCmd.AddCommand(NewExportChangesCmd())
+	rootCmd.AddCommand(NewApplyChangesCmd())
+	rootCmd.AddCommand(NewConflictsCmd())
+	rootCmd.AddCommand(NewChangesCmd())
+	rootCmd.AddCommand(NewWriteChangesCmd())
 	return rootCmd
 }
@@ -48,12 +48,19 @@ func (cmd *RunCmd) Run(ctx context.Context, options *options.Options, log log.Lo
 		return err
 	}
 
-	err = dockerlessProvider.Pull(ctx, runOptions)
+	// the pulled image must not be pruned before the workspace uses it
+	unlock, err := dockerlessProvider.LockStore(false)
 	if err != nil {
 		return err
 	}
 
-	err = dockerlessProvider.Create(ctx, options.DevContainerID, runOptions)
+	err = dockerlessProvider.Pull(ctx, runOptions)
+	if err == nil {
+		err = dockerlessProvider.Create(ctx, options.DevContainerID, runOptions)
+	}
+
+	unlock()
+
 	if err != nil {
 		return err
 	}
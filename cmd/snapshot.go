@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// NewSnapshotCmd defines the workspace snapshot commands
+func NewSnapshotCmd() *cobra.Command {
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Manage workspace snapshots",
+	}
+
+	snapshotCmd.AddCommand(NewSnapshotCreateCmd())
+	snapshotCmd.AddCommand(NewSnapshotListCmd())
+	snapshotCmd.AddCommand(NewSnapshotRestoreCmd())
+	snapshotCmd.AddCommand(NewSnapshotRmCmd())
+
+	return snapshotCmd
+}
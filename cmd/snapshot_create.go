@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// SnapshotCreateCmd holds the cmd flags
+type SnapshotCreateCmd struct{}
+
+// NewSnapshotCreateCmd defines a command
+func NewSnapshotCreateCmd() *cobra.Command {
+	cmd := &SnapshotCreateCmd{}
+	snapshotCreateCmd := &cobra.Command{
+		Use:   "create WORKSPACE [NAME]",
+		Short: "Save the rootfs and run options of a workspace",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			name := ""
+			if len(args) > 1 {
+				name = args[1]
+			}
+
+			return cmd.Run(context.Background(), options, args[0], name, log.Default)
+		},
+	}
+
+	return snapshotCreateCmd
+}
+
+// Run runs the command logic
+func (cmd *SnapshotCreateCmd) Run(ctx context.Context, options *options.Options, workspaceId, name string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	_, err = dockerlessProvider.CreateSnapshot(ctx, workspaceId, name)
+
+	return err
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// SnapshotListCmd holds the cmd flags
+type SnapshotListCmd struct {
+	JSON bool
+}
+
+// NewSnapshotListCmd defines a command
+func NewSnapshotListCmd() *cobra.Command {
+	cmd := &SnapshotListCmd{}
+	snapshotListCmd := &cobra.Command{
+		Use:     "list [WORKSPACE]",
+		Aliases: []string{"ls"},
+		Short:   "List the snapshots of a workspace, or of all workspaces",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			workspaceId := ""
+			if len(args) > 0 {
+				workspaceId = args[0]
+			}
+
+			return cmd.Run(context.Background(), options, workspaceId, log.Default)
+		},
+	}
+
+	snapshotListCmd.Flags().BoolVar(&cmd.JSON, "json", false, "Print snapshots as JSON")
+
+	return snapshotListCmd
+}
+
+// Run runs the command logic
+func (cmd *SnapshotListCmd) Run(ctx context.Context, options *options.Options, workspaceId string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := dockerlessProvider.ListSnapshots(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	if cmd.JSON {
+		out, err := json.Marshal(snapshots)
+		if err != nil {
+			return fmt.Errorf("error marshalling snapshots: %w", err)
+		}
+
+		fmt.Println(string(out))
+
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(writer, "WORKSPACE\tNAME\tCREATED\tSTORAGE")
+
+	for _, snapshot := range snapshots {
+		storage := "copy"
+		if snapshot.Overlay {
+			storage = "overlay"
+		}
+
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s\n",
+			snapshot.Workspace,
+			snapshot.Name,
+			units.HumanDuration(time.Since(snapshot.Created))+" ago",
+			storage,
+		)
+	}
+
+	return writer.Flush()
+}
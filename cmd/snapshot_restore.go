@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// SnapshotRestoreCmd holds the cmd flags
+type SnapshotRestoreCmd struct{}
+
+// NewSnapshotRestoreCmd defines a command
+func NewSnapshotRestoreCmd() *cobra.Command {
+	cmd := &SnapshotRestoreCmd{}
+	snapshotRestoreCmd := &cobra.Command{
+		Use:   "restore WORKSPACE NAME",
+		Short: "Roll a workspace back to a snapshot, stopping it first",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args[0], args[1], log.Default)
+		},
+	}
+
+	return snapshotRestoreCmd
+}
+
+// Run runs the command logic
+func (cmd *SnapshotRestoreCmd) Run(ctx context.Context, options *options.Options, workspaceId, name string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	return dockerlessProvider.RestoreSnapshot(ctx, workspaceId, name)
+}
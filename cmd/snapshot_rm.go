@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// SnapshotRmCmd holds the cmd flags
+type SnapshotRmCmd struct{}
+
+// NewSnapshotRmCmd defines a command
+func NewSnapshotRmCmd() *cobra.Command {
+	cmd := &SnapshotRmCmd{}
+	snapshotRmCmd := &cobra.Command{
+		Use:   "rm WORKSPACE NAME...",
+		Short: "Remove snapshots of a workspace",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args[0], args[1:], log.Default)
+		},
+	}
+
+	return snapshotRmCmd
+}
+
+// Run runs the command logic
+func (cmd *SnapshotRmCmd) Run(ctx context.Context, options *options.Options, workspaceId string, names []string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		err = dockerlessProvider.RemoveSnapshot(workspaceId, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
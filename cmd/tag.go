@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// TagCmd holds the cmd flags
+type TagCmd struct{}
+
+// NewTagCmd defines a command
+func NewTagCmd() *cobra.Command {
+	cmd := &TagCmd{}
+	tagCmd := &cobra.Command{
+		Use:   "tag SOURCE_IMAGE TARGET_IMAGE",
+		Short: "Create a local alias of a stored image",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			options, err := options.GlobalFromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(context.Background(), options, args[0], args[1], log.Default)
+		},
+	}
+
+	return tagCmd
+}
+
+// Run runs the command logic
+func (cmd *TagCmd) Run(ctx context.Context, options *options.Options, source, target string, log log.Logger) error {
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	return dockerlessProvider.TagImage(source, target)
+}
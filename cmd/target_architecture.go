@@ -3,8 +3,8 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"runtime"
 
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
 	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
 	"github.com/loft-sh/log"
 	"github.com/spf13/cobra"
@@ -34,6 +34,16 @@ func NewTargetArchitectureCmd() *cobra.Command {
 
 // Run runs the command logic
 func (cmd *TargetArchitectureCmd) Run(ctx context.Context, options *options.Options, log log.Logger) error {
-	fmt.Println(runtime.GOARCH)
+	dockerlessProvider, err := dockerless.NewProvider(ctx, options, log)
+	if err != nil {
+		return err
+	}
+
+	architecture, err := dockerlessProvider.TargetArchitecture(ctx, options.DevContainerID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(architecture)
 	return nil
 }
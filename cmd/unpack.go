@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// UnpackCmd holds the cmd flags
+type UnpackCmd struct {
+	Overlay bool
+}
+
+// NewUnpackCmd defines a command
+func NewUnpackCmd() *cobra.Command {
+	cmd := &UnpackCmd{}
+	unpackCmd := &cobra.Command{
+		Use:    "unpack TARGET MEDIATYPE=LAYER...",
+		Short:  "Unpack image layers into a rootfs",
+		Hidden: true,
+		Args:   cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			layers := []dockerless.Layer{}
+			for _, arg := range args[1:] {
+				layers = append(layers, dockerless.ParseLayer(arg))
+			}
+
+			return cmd.Run(context.Background(), args[0], layers, log.Default)
+		},
+	}
+
+	unpackCmd.Flags().BoolVar(&cmd.Overlay, "overlay", false, "Extract each layer in its own directory inside TARGET, for overlayfs")
+
+	return unpackCmd
+}
+
+// Run runs the command logic, this is expected to be executed
+// inside the container's user namespace
+func (cmd *UnpackCmd) Run(ctx context.Context, target string, layers []dockerless.Layer, log log.Logger) error {
+	if cmd.Overlay {
+		return dockerless.UnpackLayerSnapshots(target, layers, log)
+	}
+
+	return dockerless.UnpackLayers(target, layers, log)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/dockerless"
+	"github.com/spf13/cobra"
+)
+
+// WriteChangesCmd holds the cmd flags
+type WriteChangesCmd struct {
+	Exported bool
+}
+
+// NewWriteChangesCmd defines a command
+func NewWriteChangesCmd() *cobra.Command {
+	cmd := &WriteChangesCmd{}
+	writeChangesCmd := &cobra.Command{
+		Use:    "write-changes CHANGES OUTPUT",
+		Short:  "Write exported changes as a layer tarball",
+		Hidden: true,
+		Args:   cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), args[0], args[1])
+		},
+	}
+
+	writeChangesCmd.Flags().BoolVar(&cmd.Exported, "exported", false, "The changes were written by export-changes")
+
+	return writeChangesCmd
+}
+
+// Run runs the command logic, this is expected to be executed
+// inside the container's user namespace
+func (cmd *WriteChangesCmd) Run(ctx context.Context, changes, output string) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	err = dockerless.WriteChangesTar(changes, cmd.Exported, file)
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,239 @@
+package dockerless
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sys/unix"
+)
+
+// hardlinkKey identifies a file by its device and inode, to detect hardlinks.
+type hardlinkKey struct {
+	dev uint64
+	ino uint64
+}
+
+// WriteTar will write the content of root directory as a tarball, preserving
+// ownership, permissions, mtimes, hardlinks, symlinks, devices and xattrs.
+// Paths are relative to root, which itself is not part of the tarball.
+func WriteTar(root string, writer io.Writer) error {
+	tarWriter := tar.NewWriter(writer)
+	hardlinks := map[hardlinkKey]string{}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == root {
+			return nil
+		}
+
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		return writeTarEntry(tarWriter, path, filepath.ToSlash(name), hardlinks)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tarWriter.Close()
+}
+
+// writeTarEntry will write the file at path in the tarball, with input name.
+func writeTarEntry(tarWriter *tar.Writer, path, name string, hardlinks map[hardlinkKey]string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	// sockets cannot be stored in tarballs
+	if info.Mode()&fs.ModeSocket != 0 {
+		return nil
+	}
+
+	link := ""
+	if info.Mode()&fs.ModeSymlink != 0 {
+		link, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	// ownership is kept numeric, names depend on the host
+	header.Uname = ""
+	header.Gname = ""
+	header.Format = tar.FormatPAX
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if ok && info.Mode().IsRegular() && stat.Nlink > 1 {
+		key := hardlinkKey{dev: uint64(stat.Dev), ino: stat.Ino} //nolint:unconvert // Dev is not uint64 on all archs
+
+		target, found := hardlinks[key]
+		if found {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = target
+			header.Size = 0
+		} else {
+			hardlinks[key] = name
+		}
+	}
+
+	err = addXattrs(path, header)
+	if err != nil {
+		return err
+	}
+
+	err = tarWriter.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	_, err = io.Copy(tarWriter, file)
+
+	return err
+}
+
+// addXattrs will add the extended attributes of the file at path to input header.
+func addXattrs(path string, header *tar.Header) error {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size <= 0 {
+		// the filesystem may not support xattrs at all
+		return nil
+	}
+
+	buffer := make([]byte, size)
+
+	size, err = unix.Llistxattr(path, buffer)
+	if err != nil {
+		return nil
+	}
+
+	for _, attr := range strings.Split(string(buffer[:size]), "\x00") {
+		if attr == "" {
+			continue
+		}
+
+		// overlayfs xattrs are converted to whiteouts, see WriteChangesTar
+		if strings.HasPrefix(attr, overlayXattrPrefix) {
+			continue
+		}
+
+		valueSize, err := unix.Lgetxattr(path, attr, nil)
+		if err != nil {
+			continue
+		}
+
+		value := make([]byte, valueSize)
+
+		valueSize, err = unix.Lgetxattr(path, attr, value)
+		if err != nil {
+			continue
+		}
+
+		if header.PAXRecords == nil {
+			header.PAXRecords = map[string]string{}
+		}
+
+		header.PAXRecords["SCHILY.xattr."+attr] = string(value[:valueSize])
+	}
+
+	return nil
+}
+
+// fileLayer is an uncompressed layer stored in a tarball on disk.
+// Its digest and diff id are the same.
+type fileLayer struct {
+	path      string
+	digest    v1.Hash
+	size      int64
+	mediaType types.MediaType
+}
+
+// newFileLayer returns the uncompressed layer stored in the tarball at path,
+// with input media type, either the OCI or the docker one.
+func newFileLayer(path string, mediaType types.MediaType) (*fileLayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	hasher := sha256.New()
+
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileLayer{
+		path:      path,
+		digest:    v1.Hash{Algorithm: "sha256", Hex: fmt.Sprintf("%x", hasher.Sum(nil))},
+		size:      size,
+		mediaType: mediaType,
+	}, nil
+}
+
+// Digest implements v1.Layer.
+func (l *fileLayer) Digest() (v1.Hash, error) {
+	return l.digest, nil
+}
+
+// DiffID implements v1.Layer.
+func (l *fileLayer) DiffID() (v1.Hash, error) {
+	return l.digest, nil
+}
+
+// Compressed implements v1.Layer.
+func (l *fileLayer) Compressed() (io.ReadCloser, error) {
+	return os.Open(l.path)
+}
+
+// Uncompressed implements v1.Layer.
+func (l *fileLayer) Uncompressed() (io.ReadCloser, error) {
+	return os.Open(l.path)
+}
+
+// Size implements v1.Layer.
+func (l *fileLayer) Size() (int64, error) {
+	return l.size, nil
+}
+
+// MediaType implements v1.Layer.
+func (l *fileLayer) MediaType() (types.MediaType, error) {
+	return l.mediaType, nil
+}
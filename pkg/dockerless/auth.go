@@ -0,0 +1,237 @@
+package dockerless
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// AuthFile returns the path of the credentials file managed by login and logout.
+// This uses the same format as docker's config.json.
+func (p *DockerlessProvider) AuthFile() string {
+	return filepath.Join(p.Config.TargetDir, "auth.json")
+}
+
+// Keychain returns the keychain used to authenticate against registries.
+// Credentials are looked up, in order, in:
+//   - the REGISTRY_CREDENTIALS option
+//   - the credentials stored by login under TARGET_DIR
+//   - $REGISTRY_AUTH_FILE and $XDG_RUNTIME_DIR/containers/auth.json
+//   - ~/.docker/config.json, including its docker-credential-* helpers
+func (p *DockerlessProvider) Keychain() (authn.Keychain, error) {
+	credentials, err := parseRegistryCredentials(p.Config.RegistryCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	keychains := []authn.Keychain{
+		credentials,
+		&configFileKeychain{path: p.AuthFile()},
+	}
+
+	if os.Getenv("REGISTRY_AUTH_FILE") != "" {
+		keychains = append(keychains, &configFileKeychain{path: os.Getenv("REGISTRY_AUTH_FILE")})
+	}
+
+	if os.Getenv("XDG_RUNTIME_DIR") != "" {
+		keychains = append(keychains, &configFileKeychain{
+			path: filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "containers", "auth.json"),
+		})
+	}
+
+	keychains = append(keychains, authn.DefaultKeychain)
+
+	return authn.NewMultiKeychain(keychains...), nil
+}
+
+// Login will store the credentials for input registry under TARGET_DIR.
+func (p *DockerlessProvider) Login(registry, username, password string) error {
+	reg, err := name.NewRegistry(registry)
+	if err != nil {
+		return err
+	}
+
+	configFile, err := loadConfigFile(p.AuthFile())
+	if err != nil {
+		return err
+	}
+
+	configFile.AuthConfigs[authKey(reg.RegistryStr())] = types.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: authKey(reg.RegistryStr()),
+	}
+
+	err = os.MkdirAll(p.Config.TargetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	err = configFile.Save()
+	if err != nil {
+		return err
+	}
+
+	p.Log.Infof("credentials for %s saved in %s", reg.RegistryStr(), p.AuthFile())
+
+	return nil
+}
+
+// Logout will remove the credentials for input registry stored under TARGET_DIR.
+func (p *DockerlessProvider) Logout(registry string) error {
+	reg, err := name.NewRegistry(registry)
+	if err != nil {
+		return err
+	}
+
+	configFile, err := loadConfigFile(p.AuthFile())
+	if err != nil {
+		return err
+	}
+
+	_, ok := configFile.AuthConfigs[authKey(reg.RegistryStr())]
+	if !ok {
+		return fmt.Errorf("not logged in to %s", reg.RegistryStr())
+	}
+
+	delete(configFile.AuthConfigs, authKey(reg.RegistryStr()))
+
+	err = configFile.Save()
+	if err != nil {
+		return err
+	}
+
+	p.Log.Infof("removed credentials for %s", reg.RegistryStr())
+
+	return nil
+}
+
+// configFileKeychain resolves credentials from a docker config.json formatted file,
+// like containers' auth.json.
+type configFileKeychain struct {
+	path string
+}
+
+// Resolve implements authn.Keychain.
+func (k *configFileKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	_, err := os.Stat(k.path)
+	if err != nil {
+		return authn.Anonymous, nil
+	}
+
+	configFile, err := loadConfigFile(k.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// credentials can be stored either per repository or per registry
+	for _, key := range []string{target.String(), target.RegistryStr()} {
+		authConfig, err := configFile.GetAuthConfig(authKey(key))
+		if err != nil {
+			return nil, err
+		}
+
+		if authConfig.Username == "" && authConfig.Password == "" &&
+			authConfig.Auth == "" && authConfig.IdentityToken == "" &&
+			authConfig.RegistryToken == "" {
+			continue
+		}
+
+		return authn.FromConfig(authn.AuthConfig{
+			Username:      authConfig.Username,
+			Password:      authConfig.Password,
+			Auth:          authConfig.Auth,
+			IdentityToken: authConfig.IdentityToken,
+			RegistryToken: authConfig.RegistryToken,
+		}), nil
+	}
+
+	return authn.Anonymous, nil
+}
+
+// staticKeychain resolves credentials from a fixed registry -> credentials map.
+type staticKeychain map[string]authn.AuthConfig
+
+// Resolve implements authn.Keychain.
+func (k staticKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	authConfig, ok := k[target.RegistryStr()]
+	if !ok {
+		return authn.Anonymous, nil
+	}
+
+	return authn.FromConfig(authConfig), nil
+}
+
+// parseRegistryCredentials will parse the REGISTRY_CREDENTIALS option.
+// The expected format is a comma or whitespace separated list of registry=username:password.
+func parseRegistryCredentials(option string) (staticKeychain, error) {
+	keychain := staticKeychain{}
+
+	entries := strings.FieldsFunc(option, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t'
+	})
+
+	for _, entry := range entries {
+		registry, credentials, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid registry credentials %q, expected registry=username:password", registry)
+		}
+
+		username, password, ok := strings.Cut(credentials, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid registry credentials for %s, expected registry=username:password", registry)
+		}
+
+		reg, err := name.NewRegistry(registry)
+		if err != nil {
+			return nil, err
+		}
+
+		keychain[reg.RegistryStr()] = authn.AuthConfig{
+			Username: username,
+			Password: password,
+		}
+	}
+
+	return keychain, nil
+}
+
+// loadConfigFile will load a docker config.json formatted file,
+// returning an empty one if it does not exist yet.
+func loadConfigFile(path string) (*configfile.ConfigFile, error) {
+	configFile := configfile.New(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return configFile, nil
+		}
+
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	err = configFile.LoadFromReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+
+	return configFile, nil
+}
+
+// authKey returns the key used for a registry inside config files,
+// docker hub uses a legacy one.
+func authKey(registry string) string {
+	if registry == name.DefaultRegistry {
+		return authn.DefaultAuthKey
+	}
+
+	return registry
+}
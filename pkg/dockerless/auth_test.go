@@ -0,0 +1,92 @@
+package dockerless
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestParseRegistryCredentials(t *testing.T) {
+	tests := []struct {
+		option  string
+		want    staticKeychain
+		wantErr bool
+	}{
+		{option: "", want: staticKeychain{}},
+		{
+			option: "ghcr.io=user:token",
+			want:   staticKeychain{"ghcr.io": {Username: "user", Password: "token"}},
+		},
+		{
+			option: "docker.io=user:pass:with:colons",
+			want:   staticKeychain{"index.docker.io": {Username: "user", Password: "pass:with:colons"}},
+		},
+		{
+			option: "ghcr.io=a:b, registry.local:5000=c:d\nquay.io=e:f",
+			want: staticKeychain{
+				"ghcr.io":             {Username: "a", Password: "b"},
+				"registry.local:5000": {Username: "c", Password: "d"},
+				"quay.io":             {Username: "e", Password: "f"},
+			},
+		},
+		{
+			option: "ghcr.io=user:",
+			want:   staticKeychain{"ghcr.io": {Username: "user"}},
+		},
+		{option: "ghcr.io", wantErr: true},
+		{option: "ghcr.io=user", wantErr: true},
+		{option: "ghcr.io=a:b,quay.io", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseRegistryCredentials(test.option)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseRegistryCredentials(%q) = %v, want an error", test.option, got)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseRegistryCredentials(%q) error = %v", test.option, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseRegistryCredentials(%q) = %v, want %v", test.option, got, test.want)
+		}
+	}
+}
+
+func TestStaticKeychainResolve(t *testing.T) {
+	keychain := staticKeychain{"ghcr.io": {Username: "user", Password: "token"}}
+
+	resource, err := name.NewRegistry("ghcr.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err := keychain.Resolve(resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := authenticator.Authorization()
+	if err != nil || auth.Username != "user" || auth.Password != "token" {
+		t.Errorf("Resolve(ghcr.io) = %v, %v, want the configured credentials", auth, err)
+	}
+
+	resource, err = name.NewRegistry("quay.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err = keychain.Resolve(resource)
+	if err != nil || authenticator != authn.Anonymous {
+		t.Errorf("Resolve(quay.io) = %v, %v, want anonymous", authenticator, err)
+	}
+}
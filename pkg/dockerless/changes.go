@@ -0,0 +1,499 @@
+package dockerless
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/loft-sh/log"
+	"golang.org/x/sys/unix"
+)
+
+// runtimePaths are created or mounted over by Enter, their changes do not belong to the workspace.
+var runtimePaths = []string{".pivot_root", "dev", "etc/hosts", "etc/resolv.conf", "proc", "tmp"}
+
+// isRuntimePath returns whether the path with input name, relative to the rootfs,
+// is or is inside one of the runtimePaths.
+func isRuntimePath(name string) bool {
+	for _, path := range runtimePaths {
+		if name == path || strings.HasPrefix(name, path+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isWhiteout returns whether the file is an overlayfs whiteout, a 0/0 character device.
+func isWhiteout(info fs.FileInfo) bool {
+	if info.Mode()&fs.ModeCharDevice == 0 {
+		return false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	return ok && stat.Rdev == 0
+}
+
+// isOpaque returns whether the directory at path hides the content of the lower ones,
+// with the overlayfs xattr.
+func isOpaque(path string) bool {
+	value := make([]byte, 1)
+
+	size, err := unix.Lgetxattr(path, overlayXattrPrefix+"opaque", value)
+
+	return err == nil && size == 1 && value[0] == 'y'
+}
+
+// lowerDirs are overlayfs lower directories, the topmost first. A plain rootfs
+// is a single lower directory.
+type lowerDirs []string
+
+// lookup returns the path and info of the file with input name, relative to the
+// rootfs, as seen through the lower directories. Returns false if missing.
+func (l lowerDirs) lookup(name string) (string, fs.FileInfo, bool) {
+	parts := strings.Split(name, "/")
+
+	for _, dir := range l {
+		opaque := false
+
+		for index := 1; index < len(parts); index++ {
+			parent := filepath.Join(dir, filepath.Join(parts[:index]...))
+
+			info, err := os.Lstat(parent)
+			if err != nil {
+				break
+			}
+
+			// a file or whiteout hides everything below
+			if !info.IsDir() {
+				return "", nil, false
+			}
+
+			if isOpaque(parent) {
+				opaque = true
+			}
+		}
+
+		path := filepath.Join(dir, name)
+
+		info, err := os.Lstat(path)
+		if err == nil {
+			if isWhiteout(info) {
+				return "", nil, false
+			}
+
+			return path, info, true
+		}
+
+		if opaque {
+			return "", nil, false
+		}
+	}
+
+	return "", nil, false
+}
+
+// walkChanges will call input function for each file of changesDir, with its
+// name relative to changesDir, skipping the runtimePaths. changesDir is in the
+// overlayfs upper directory format. If exported is set, changesDir was written by
+// ExportChanges and its OCI whiteout files are whiteouts too, reported with the
+// name of the deleted file. Elsewhere, like in a rootfs, they are regular files.
+func walkChanges(changesDir string, exported bool, change func(name string, info fs.FileInfo, whiteout bool) error) error {
+	return filepath.WalkDir(changesDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(changesDir, path)
+		if err != nil {
+			return err
+		}
+
+		if name == "." {
+			return nil
+		}
+
+		if isRuntimePath(name) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if exported && strings.HasPrefix(entry.Name(), whiteoutPrefix) {
+			hidden, ok := hiddenName(entry.Name())
+			if !ok {
+				return fmt.Errorf("%s: invalid whiteout", name)
+			}
+
+			return change(filepath.Join(filepath.Dir(name), hidden), info, true)
+		}
+
+		return change(name, info, isWhiteout(info))
+	})
+}
+
+// ExportChanges will record in out the changes of rootfs against base, in the
+// overlayfs upper directory format: changed files are cloned, with their parent
+// directories. Deleted files are recorded as OCI whiteout files, as overlayfs
+// whiteouts cannot always be created inside a user namespace.
+// This is meant to be run inside the container's user namespace, see the hidden
+// "export-changes" command, in order to preserve ownership of the files.
+// Files named like whiteouts cannot be represented in a layer, they are rejected
+// before anything is written to out.
+func ExportChanges(base, rootfs, out string, logger log.Logger) error {
+	c := &cloner{
+		hardlinks: map[hardlinkKey]string{},
+		reflink:   true,
+		logger:    logger,
+	}
+
+	// changed paths, in walk order so that directories come before their content
+	changed := []string{}
+	changedDirs := map[string]bool{}
+
+	err := walkChanges(rootfs, false, func(name string, info fs.FileInfo, _ bool) error {
+		baseInfo, err := os.Lstat(filepath.Join(base, name))
+		if err == nil && !fileChanged(baseInfo, info) {
+			return nil
+		}
+
+		// they would be taken for the whiteouts of the output
+		if strings.HasPrefix(filepath.Base(name), whiteoutPrefix) {
+			return fmt.Errorf("cannot represent %s in a layer: names starting with %s are reserved for whiteouts", name, whiteoutPrefix)
+		}
+
+		changed = append(changed, name)
+		changedDirs[name] = info.IsDir()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.clone(rootfs, out)
+	if err != nil {
+		return err
+	}
+
+	// directories are only created in out when something changed inside them
+	created := map[string]bool{}
+	dirs := []string{}
+
+	createParents := func(name string) error {
+		parts := strings.Split(name, "/")
+
+		for index := 1; index < len(parts); index++ {
+			parent := filepath.Join(parts[:index]...)
+			if created[parent] {
+				continue
+			}
+
+			err := c.clone(filepath.Join(rootfs, parent), filepath.Join(out, parent))
+			if err != nil {
+				return err
+			}
+
+			created[parent] = true
+			dirs = append(dirs, parent)
+		}
+
+		return nil
+	}
+
+	for _, name := range changed {
+		err = createParents(name)
+		if err != nil {
+			return err
+		}
+
+		err = c.clone(filepath.Join(rootfs, name), filepath.Join(out, name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		if changedDirs[name] {
+			created[name] = true
+			dirs = append(dirs, name)
+		}
+	}
+
+	err = walkChanges(base, false, func(name string, info fs.FileInfo, _ bool) error {
+		rootfsInfo, err := os.Lstat(filepath.Join(rootfs, name))
+		if err == nil {
+			// replaced by a file, which hides the whole directory
+			if info.IsDir() && !rootfsInfo.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		err = createParents(name)
+		if err != nil {
+			return err
+		}
+
+		whiteout := filepath.Join(out, filepath.Dir(name), whiteoutPrefix+filepath.Base(name))
+
+		err = os.WriteFile(whiteout, nil, 0o600)
+		if err != nil {
+			return fmt.Errorf("%s: creating whiteout: %w", name, err)
+		}
+
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// cloning the content of directories changes their modification times
+	for index := len(dirs) - 1; index >= 0; index-- {
+		err = copyTimes(filepath.Join(rootfs, dirs[index]), filepath.Join(out, dirs[index]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return copyTimes(rootfs, out)
+}
+
+// ApplyChanges will apply the changes recorded in changesDir by ExportChanges to the
+// rootfs at target.
+// This is meant to be run inside the container's user namespace, see the hidden
+// "apply-changes" command, in order to preserve ownership of the files.
+func ApplyChanges(changesDir, target string, logger log.Logger) error {
+	c := &cloner{
+		hardlinks: map[hardlinkKey]string{},
+		reflink:   true,
+		logger:    logger,
+	}
+
+	dirs := []string{}
+
+	err := walkChanges(changesDir, true, func(name string, info fs.FileInfo, whiteout bool) error {
+		path := filepath.Join(target, name)
+
+		if whiteout {
+			return os.RemoveAll(path)
+		}
+
+		targetInfo, err := os.Lstat(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		// directories are merged unless opaque, everything else is replaced
+		opaque := info.IsDir() && isOpaque(filepath.Join(changesDir, name))
+		if targetInfo != nil && (!info.IsDir() || !targetInfo.IsDir() || opaque) {
+			err = os.RemoveAll(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = c.clone(filepath.Join(changesDir, name), path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		if info.IsDir() {
+			dirs = append(dirs, name)
+
+			// the opaque xattr only makes sense to overlayfs
+			if opaque {
+				_ = unix.Lremovexattr(path, overlayXattrPrefix+"opaque")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for index := len(dirs) - 1; index >= 0; index-- {
+		err = copyTimes(filepath.Join(changesDir, dirs[index]), filepath.Join(target, dirs[index]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Conflicts returns the paths changed in changesDir, in the overlayfs upper directory
+// format or written by ExportChanges if exported is set, that also differ between the
+// lower directories oldLower and newLower, that is the workspace changes rebasing
+// would overwrite.
+// This is meant to be run inside the container's user namespace, see the hidden
+// "conflicts" command, in order to read all the files.
+func Conflicts(changesDir string, exported bool, oldLower, newLower []string) ([]string, error) {
+	oldLowers := lowerDirs(oldLower)
+	newLowers := lowerDirs(newLower)
+	conflicts := []string{}
+
+	err := walkChanges(changesDir, exported, func(name string, info fs.FileInfo, whiteout bool) error {
+		oldPath, oldInfo, oldFound := oldLowers.lookup(name)
+		newPath, newInfo, newFound := newLowers.lookup(name)
+
+		// directories are merged, unless opaque, only files matter below them
+		merged := !whiteout && info.IsDir() && !isOpaque(filepath.Join(changesDir, name))
+		if merged {
+			oldFound = oldFound && !oldInfo.IsDir()
+			newFound = newFound && !newInfo.IsDir()
+		}
+
+		// deleted by the new image as well
+		if whiteout && !newFound {
+			return nil
+		}
+
+		conflict := oldFound != newFound
+		if oldFound && newFound {
+			same, err := sameFile(oldPath, oldInfo, newPath, newInfo)
+			if err != nil {
+				return err
+			}
+
+			conflict = !same
+		}
+
+		if conflict {
+			conflicts = append(conflicts, "/"+name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+// fileChanged returns whether the metadata of a file differ, as docker diff does.
+// Modification times and sizes of directories are not relevant.
+func fileChanged(old, current fs.FileInfo) bool {
+	oldStat, oldOk := old.Sys().(*syscall.Stat_t)
+	stat, ok := current.Sys().(*syscall.Stat_t)
+
+	if !oldOk || !ok {
+		return true
+	}
+
+	if old.Mode() != current.Mode() || oldStat.Uid != stat.Uid || oldStat.Gid != stat.Gid || oldStat.Rdev != stat.Rdev {
+		return true
+	}
+
+	if current.IsDir() {
+		return false
+	}
+
+	return old.Size() != current.Size() || oldStat.Mtim != stat.Mtim
+}
+
+// sameFile returns whether the files at path and otherPath have the same type,
+// ownership, permissions and content.
+func sameFile(path string, info fs.FileInfo, otherPath string, otherInfo fs.FileInfo) (bool, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	otherStat, otherOk := otherInfo.Sys().(*syscall.Stat_t)
+
+	if !ok || !otherOk {
+		return false, nil
+	}
+
+	if info.Mode() != otherInfo.Mode() || stat.Uid != otherStat.Uid || stat.Gid != otherStat.Gid || stat.Rdev != otherStat.Rdev {
+		return false, nil
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		link, err := os.Readlink(path)
+		if err != nil {
+			return false, err
+		}
+
+		otherLink, err := os.Readlink(otherPath)
+		if err != nil {
+			return false, err
+		}
+
+		return link == otherLink, nil
+	case info.Mode().IsRegular():
+		if info.Size() != otherInfo.Size() {
+			return false, nil
+		}
+
+		return sameContent(path, otherPath)
+	}
+
+	return true, nil
+}
+
+// sameContent returns whether the regular files at path and otherPath have the same content.
+func sameContent(path, otherPath string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	otherFile, err := os.Open(otherPath)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() { _ = otherFile.Close() }()
+
+	reader := bufio.NewReader(file)
+	otherReader := bufio.NewReader(otherFile)
+
+	buffer := make([]byte, 32*1024)
+	otherBuffer := make([]byte, 32*1024)
+
+	for {
+		size, err := io.ReadFull(reader, buffer)
+		otherSize, otherErr := io.ReadFull(otherReader, otherBuffer)
+
+		if !bytes.Equal(buffer[:size], otherBuffer[:otherSize]) {
+			return false, nil
+		}
+
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return errors.Is(otherErr, io.EOF) || errors.Is(otherErr, io.ErrUnexpectedEOF), nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if otherErr != nil {
+			return false, otherErr
+		}
+	}
+}
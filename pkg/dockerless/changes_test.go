@@ -0,0 +1,157 @@
+package dockerless
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/log"
+)
+
+func TestWalkChangesWhiteouts(t *testing.T) {
+	changesDir := t.TempDir()
+
+	for _, file := range []string{"dir/.wh.deleted", "dir/kept", "tmp/ignored"} {
+		writeTestFile(t, filepath.Join(changesDir, file))
+	}
+
+	tests := []struct {
+		exported bool
+		want     map[string]bool
+	}{
+		{
+			exported: false,
+			want:     map[string]bool{"dir": false, "dir/.wh.deleted": false, "dir/kept": false},
+		},
+		{
+			exported: true,
+			want:     map[string]bool{"dir": false, "dir/deleted": true, "dir/kept": false},
+		},
+	}
+
+	for _, test := range tests {
+		got := map[string]bool{}
+
+		err := walkChanges(changesDir, test.exported, func(name string, _ fs.FileInfo, whiteout bool) error {
+			got[name] = whiteout
+
+			return nil
+		})
+		if err != nil {
+			t.Errorf("walkChanges(exported=%v) error = %v", test.exported, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("walkChanges(exported=%v) = %v, want %v", test.exported, got, test.want)
+		}
+	}
+
+	// whiteouts hiding their parent directory are rejected
+	writeTestFile(t, filepath.Join(changesDir, "dir", ".wh..."))
+
+	err := walkChanges(changesDir, true, func(string, fs.FileInfo, bool) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "invalid whiteout") {
+		t.Errorf("walkChanges() error = %v, want an invalid whiteout", err)
+	}
+}
+
+func TestTreeChangesWhiteoutNames(t *testing.T) {
+	tempDir := t.TempDir()
+	base := filepath.Join(tempDir, "base")
+	rootfs := filepath.Join(tempDir, "rootfs")
+
+	modTime := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, dir := range []string{base, rootfs} {
+		writeTestFile(t, filepath.Join(dir, "etc", "passwd"))
+
+		err := os.Chtimes(filepath.Join(dir, "etc", "passwd"), modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a regular file of the workspace, not a whiteout hiding /etc/passwd
+	writeTestFile(t, filepath.Join(rootfs, "etc", ".wh.passwd"))
+
+	changes, err := TreeChanges(base, rootfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Change{
+		{Path: "/etc", Kind: ChangeModified},
+		{Path: "/etc/.wh.passwd", Kind: ChangeAdded},
+	}
+
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("TreeChanges() = %v, want %v", changes, want)
+	}
+}
+
+func TestExportChanges(t *testing.T) {
+	tempDir := t.TempDir()
+	base := filepath.Join(tempDir, "base")
+	rootfs := filepath.Join(tempDir, "rootfs")
+	out := filepath.Join(tempDir, "out")
+	target := filepath.Join(tempDir, "target")
+
+	for _, dir := range []string{base, rootfs, target} {
+		for _, file := range []string{"etc/passwd", "etc/group", "usr/bin/sh"} {
+			writeTestFile(t, filepath.Join(dir, file))
+		}
+	}
+
+	err := os.Remove(filepath.Join(rootfs, "etc", "group"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(rootfs, "etc", "passwd"), []byte("changed"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(rootfs, "home", "dev", "file"))
+
+	err = ExportChanges(base, rootfs, out, log.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ApplyChanges(out, target, log.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := TreeChanges(rootfs, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, change := range changes {
+		// directories the changes were applied to have other times, not other content
+		if change.Kind != ChangeModified || !strings.Contains("/etc /home /home/dev", change.Path) {
+			t.Errorf("applied changes differ from the rootfs: %v", change)
+		}
+	}
+
+	// files named like whiteouts cannot be exported
+	writeTestFile(t, filepath.Join(rootfs, "etc", ".wh.passwd"))
+
+	err = ExportChanges(base, rootfs, filepath.Join(tempDir, "reserved"), log.Discard)
+	if err == nil || !strings.Contains(err.Error(), "cannot represent etc/.wh.passwd in a layer") {
+		t.Errorf("ExportChanges() error = %v, want reserved names to be rejected", err)
+	}
+
+	// nothing is written before the rejection
+	if Exist(filepath.Join(tempDir, "reserved")) {
+		t.Errorf("ExportChanges() wrote changes before rejecting a reserved name")
+	}
+}
@@ -0,0 +1,387 @@
+package dockerless
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/loft-sh/log"
+	"golang.org/x/sys/unix"
+)
+
+// BasesDir returns the directory holding the rootfs extracted once for each image,
+// workspaces not using overlayfs are cloned from.
+func (p *DockerlessProvider) BasesDir() string {
+	return filepath.Join(p.Config.TargetDir, "bases")
+}
+
+// baseDir returns the directory holding the extracted rootfs of the image with input digest.
+func (p *DockerlessProvider) baseDir(digest v1.Hash) string {
+	return filepath.Join(p.BasesDir(), digest.Algorithm, digest.Hex)
+}
+
+// prepareBase will extract input layers of the image with input digest in its base
+// rootfs, unless already done.
+func (p *DockerlessProvider) prepareBase(workspaceId string, digest v1.Hash, layers []Layer) error {
+	base := p.baseDir(digest)
+	if Exist(base) {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(base), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// extracted aside then renamed, so that partial rootfs are never cloned
+	tempDir := filepath.Join(filepath.Dir(base), ".extract-"+workspaceId)
+
+	// left by a previous extraction that was killed, layers must not be applied on top
+	err = NamespacedCommand(workspaceId, "rm", "-rf", tempDir).Run()
+	if err != nil {
+		return fmt.Errorf("removing previous extraction: %w", err)
+	}
+
+	p.Log.Debugf("unpacking %d layers", len(layers))
+
+	// all the layers are unpacked natively by a single helper process
+	// running inside the user namespace
+	err = unpackInNamespace(workspaceId, tempDir, layers)
+	if err == nil {
+		err = os.Rename(tempDir, base)
+	}
+
+	if err != nil {
+		_ = NamespacedCommand(workspaceId, "rm", "-rf", tempDir).Run()
+
+		// extracted concurrently by another workspace
+		if Exist(base) {
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// cloneInNamespace will clone the base rootfs of the image with input digest to target,
+// using the hidden "clone" command in a new user namespace for the container with input id.
+func (p *DockerlessProvider) cloneInNamespace(workspaceId string, digest v1.Hash, target string) error {
+	return cloneTreeInNamespace(workspaceId, p.baseDir(digest), target)
+}
+
+// cloneTreeInNamespace will clone src to dst, using the hidden "clone" command
+// in a new user namespace for the container with input id.
+func cloneTreeInNamespace(workspaceId, src, dst string) error {
+	cmd := NamespacedCommand(workspaceId, os.Args[0], "clone", src, dst)
+	cmd.Env = os.Environ()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("cloning %s: %w", filepath.Base(src), err)
+	}
+
+	return nil
+}
+
+// unusedBaseDirs returns the base rootfs of the images whose digest is not in input ones.
+func (p *DockerlessProvider) unusedBaseDirs(digests map[string]bool) ([]string, error) {
+	unused := []string{}
+
+	algorithms, err := os.ReadDir(p.BasesDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return unused, nil
+		}
+
+		return nil, err
+	}
+
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue
+		}
+
+		bases, err := os.ReadDir(filepath.Join(p.BasesDir(), algorithm.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, base := range bases {
+			// temporary directories may belong to a running extraction
+			if !strings.HasPrefix(base.Name(), ".") && !digests[algorithm.Name()+":"+base.Name()] {
+				unused = append(unused, filepath.Join(p.BasesDir(), algorithm.Name(), base.Name()))
+			}
+		}
+	}
+
+	return unused, nil
+}
+
+// cloner copies a directory tree, sharing the file contents with reflinks when the
+// filesystem supports them (btrfs, XFS), copying them otherwise.
+type cloner struct {
+	hardlinks map[hardlinkKey]string
+	reflink   bool
+	logger    log.Logger
+}
+
+// CloneTree will clone the content of src to dst, preserving ownership, permissions,
+// mtimes, hardlinks, symlinks, devices and xattrs. Files never share their content
+// with src, unless through copy-on-write reflinks.
+// This is meant to be run inside the container's user namespace, see the hidden
+// "clone" command, in order to preserve ownership of the files.
+func CloneTree(src, dst string, logger log.Logger) error {
+	c := &cloner{
+		hardlinks: map[hardlinkKey]string{},
+		reflink:   true,
+		logger:    logger,
+	}
+
+	// directories modification times are restored at the end, as
+	// cloning their content changes them
+	dirs := []string{}
+
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, name)
+
+		err = c.clone(path, target)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		if entry.IsDir() {
+			dirs = append(dirs, name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for index := len(dirs) - 1; index >= 0; index-- {
+		err = copyTimes(filepath.Join(src, dirs[index]), filepath.Join(dst, dirs[index]))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.reflink {
+		logger.Debugf("cloned %s with reflinks", src)
+	} else {
+		logger.Debugf("copied %s, reflinks are not supported", src)
+	}
+
+	return nil
+}
+
+// clone will clone the file at path to target.
+func (c *cloner) clone(path, target string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("unsupported file info")
+	}
+
+	mode := info.Mode()
+
+	switch {
+	case mode.IsDir():
+		err = os.Mkdir(target, 0o755)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	case mode.IsRegular():
+		key := hardlinkKey{dev: uint64(stat.Dev), ino: stat.Ino} //nolint:unconvert // Dev is not uint64 on all archs
+
+		if stat.Nlink > 1 {
+			linked, found := c.hardlinks[key]
+			if found {
+				// hardlinks share the inode, its metadata is already set
+				return os.Link(linked, target)
+			}
+
+			c.hardlinks[key] = target
+		}
+
+		err = c.cloneFile(path, target)
+		if err != nil {
+			return err
+		}
+	case mode&fs.ModeSymlink != 0:
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+
+		err = os.Symlink(link, target)
+		if err != nil {
+			return err
+		}
+	case mode&(fs.ModeDevice|fs.ModeCharDevice|fs.ModeNamedPipe) != 0:
+		err = unix.Mknod(target, stat.Mode, int(stat.Rdev))
+		if err != nil {
+			// device nodes cannot be created inside a user namespace
+			c.logger.Debugf("skipping device %s: %v", path, err)
+
+			return nil
+		}
+	default:
+		c.logger.Debugf("skipping unsupported file %s", path)
+
+		return nil
+	}
+
+	err = os.Lchown(target, int(stat.Uid), int(stat.Gid))
+	if err != nil {
+		return err
+	}
+
+	// chown clears setuid/setgid bits, so chmod needs to happen after it
+	if mode&fs.ModeSymlink == 0 {
+		err = os.Chmod(target, mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = copyXattrs(path, target, c.logger)
+	if err != nil {
+		return err
+	}
+
+	if mode.IsDir() {
+		return nil
+	}
+
+	return copyTimes(path, target)
+}
+
+// cloneFile will clone the content of the regular file at path to target, with a
+// reflink if supported, else with a copy.
+func (c *cloner) cloneFile(path, target string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = source.Close() }()
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	if c.reflink {
+		err = unix.IoctlFileClone(int(file.Fd()), int(source.Fd()))
+		if err == nil {
+			return nil
+		}
+
+		// once unsupported, it is for the whole tree
+		c.logger.Debugf("reflink of %s failed, copying instead: %v", path, err)
+		c.reflink = false
+	}
+
+	_, err = io.Copy(file, source)
+
+	return err
+}
+
+// copyXattrs will copy the extended attributes of the file at path to target.
+func copyXattrs(path, target string, logger log.Logger) error {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size <= 0 {
+		// the filesystem may not support xattrs at all
+		return nil
+	}
+
+	buffer := make([]byte, size)
+
+	size, err = unix.Llistxattr(path, buffer)
+	if err != nil {
+		return nil
+	}
+
+	for _, attr := range strings.Split(string(buffer[:size]), "\x00") {
+		if attr == "" {
+			continue
+		}
+
+		valueSize, err := unix.Lgetxattr(path, attr, nil)
+		if err != nil {
+			continue
+		}
+
+		value := make([]byte, valueSize)
+
+		valueSize, err = unix.Lgetxattr(path, attr, value)
+		if err != nil {
+			continue
+		}
+
+		err = unix.Lsetxattr(target, attr, value[:valueSize], 0)
+		if err != nil {
+			// namespaces like trusted.* are not available to unprivileged users
+			if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP) {
+				logger.Debugf("skipping xattr %s on %s: %v", attr, path, err)
+
+				continue
+			}
+
+			return fmt.Errorf("setting xattr %s: %w", attr, err)
+		}
+	}
+
+	return nil
+}
+
+// copyTimes will set the access and modification times of target to the ones of path.
+func copyTimes(path, target string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	times := []unix.Timespec{
+		unix.NsecToTimespec(syscall.TimespecToNsec(stat.Atim)),
+		unix.NsecToTimespec(syscall.TimespecToNsec(stat.Mtim)),
+	}
+
+	err = unix.UtimesNanoAt(unix.AT_FDCWD, target, times, unix.AT_SYMLINK_NOFOLLOW)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil
+	}
+
+	return err
+}
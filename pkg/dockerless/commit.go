@@ -0,0 +1,255 @@
+package dockerless
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/driver"
+)
+
+// Commit will store the workspace with input id as a new local image with input name,
+// made of the image it was created from and of a layer holding the workspace's changes.
+// The image config gets the environment, command, user and labels of the workspace.
+// Returns the digest of the new image.
+func (p *DockerlessProvider) Commit(ctx context.Context, workspaceId, image, message, author string) (v1.Hash, error) {
+	err := checkWorkspaceId(workspaceId)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	if parseImportReference(image) != nil {
+		return v1.Hash{}, fmt.Errorf("cannot commit an image as %s, imported images are named after their source", image)
+	}
+
+	ref, err := localImageName(image)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	runOptionsBytes, err := os.ReadFile(filepath.Join(p.Config.TargetDir, "status", workspaceId, "runOptions"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return v1.Hash{}, fmt.Errorf("container %s does not exist", workspaceId)
+		}
+
+		return v1.Hash{}, err
+	}
+
+	runOptions := &driver.RunOptions{}
+
+	err = json.Unmarshal(runOptionsBytes, runOptions)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	manifest, digest, err := p.workspaceManifest(workspaceId)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	// the original image may be untagged, its manifest is kept while workspaces use it
+	base, err := layout.Path(p.StoreDir()).Image(digest)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	_, err = GetPid(workspaceId)
+	if err == nil {
+		p.Log.Warnf("container %s is running, files being written might be inconsistent", workspaceId)
+	}
+
+	p.Log.Infof("committing %s", workspaceId)
+
+	err = os.MkdirAll(p.ingestDir(), 0o750)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	tempDir, err := os.MkdirTemp(p.ingestDir(), "commit-")
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	// the workspace may be running, its namespaces are not reused
+	namespaceId := "commit-" + workspaceId
+
+	// exported changes belong to the users of the container's user namespace
+	defer func() {
+		_ = NamespacedCommand(namespaceId, "rm", "-rf", tempDir).Run()
+		_ = os.RemoveAll(tempDir)
+	}()
+
+	changesDir := filepath.Join(p.OverlayDir(workspaceId), "upper")
+	changesArgs := []string{}
+
+	_, overlay := p.workspaceLayers(workspaceId)
+	if !overlay {
+		layers, err := p.manifestLayers(manifest)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+
+		err = p.prepareBase(namespaceId, digest, layers)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+
+		changesDir = filepath.Join(tempDir, "changes")
+		changesArgs = append(changesArgs, "--exported")
+
+		err = p.changesInNamespace(namespaceId, "export-changes", p.baseDir(digest), filepath.Join(p.Config.TargetDir, "rootfs", workspaceId), changesDir)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+	}
+
+	layerPath := filepath.Join(tempDir, "layer.tar")
+
+	err = p.changesInNamespace(namespaceId, "write-changes", append(changesArgs, changesDir, layerPath)...)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	mediaType, err := uncompressedLayerMediaType(base)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	layer, err := newFileLayer(layerPath, mediaType)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	img, err := commitImage(base, layer, runOptions, message, author)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	err = p.saveImage(ctx, ref.Name(), img, nil, nil)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	imageDigest, err := img.Digest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	p.Log.Infof("committed %s as %s", workspaceId, ref.Name())
+
+	return imageDigest, nil
+}
+
+// commitImage returns input base image with input layer on top, and the config of
+// the container described by input run options.
+func commitImage(base v1.Image, layer v1.Layer, runOptions *driver.RunOptions, message, author string) (v1.Image, error) {
+	configFile, err := base.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	configFile = configFile.DeepCopy()
+	now := v1.Time{Time: time.Now().UTC()}
+
+	env := config.ObjectToList(runOptions.Env)
+	sort.Strings(env)
+
+	configFile.Created = now
+	configFile.Author = author
+	configFile.Config.Labels = containerLabels(runOptions, &configFile.Config)
+	configFile.Config.Env = env
+	configFile.Config.User = runOptions.User
+
+	// the command was resolved against the image config when the workspace was created
+	configFile.Config.Entrypoint = []string{runOptions.Entrypoint}
+	configFile.Config.Cmd = runOptions.Cmd
+
+	img, err := mutate.ConfigFile(base, configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return mutate.Append(img, mutate.Addendum{
+		Layer: layer,
+		History: v1.History{
+			Author:    author,
+			Created:   now,
+			CreatedBy: "devpod-provider-dockerless commit",
+			Comment:   message,
+		},
+	})
+}
+
+// uncompressedLayerMediaType returns the media type of the uncompressed layers added to
+// input image, docker or OCI like its manifest: registries reject mixed manifests.
+func uncompressedLayerMediaType(img v1.Image) (types.MediaType, error) {
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return "", err
+	}
+
+	if mediaType == types.DockerManifestSchema2 {
+		return types.DockerUncompressedLayer, nil
+	}
+
+	return types.OCIUncompressedLayer, nil
+}
+
+// WriteChangesTar will write the changes recorded in changesDir, in the overlayfs upper
+// directory format or written by ExportChanges if exported is set, as an image layer
+// tarball, whiteouts being converted to the OCI format.
+// This is meant to be run inside the container's user namespace, see the hidden
+// "write-changes" command, in order to read all the files.
+func WriteChangesTar(changesDir string, exported bool, writer io.Writer) error {
+	tarWriter := tar.NewWriter(writer)
+	hardlinks := map[hardlinkKey]string{}
+
+	err := walkChanges(changesDir, exported, func(name string, info fs.FileInfo, whiteout bool) error {
+		name = filepath.ToSlash(name)
+
+		if whiteout {
+			return writeWhiteout(tarWriter, path.Join(path.Dir(name), whiteoutPrefix+path.Base(name)), info.ModTime())
+		}
+
+		err := writeTarEntry(tarWriter, filepath.Join(changesDir, name), name, hardlinks)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && isOpaque(filepath.Join(changesDir, name)) {
+			return writeWhiteout(tarWriter, path.Join(name, whiteoutOpaqueDir), info.ModTime())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return tarWriter.Close()
+}
+
+// writeWhiteout will write an OCI whiteout with input name in the tarball.
+func writeWhiteout(tarWriter *tar.Writer, name string, modTime time.Time) error {
+	return tarWriter.WriteHeader(&tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0o600,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	})
+}
@@ -0,0 +1,90 @@
+package dockerless
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/loft-sh/devpod/pkg/driver"
+)
+
+func TestCommitImageMediaTypes(t *testing.T) {
+	layerPath := filepath.Join(t.TempDir(), "layer.tar")
+
+	file, err := os.Create(layerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tar.NewWriter(file).Close()
+	if err == nil {
+		err = file.Close()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseLayer, err := newFileLayer(layerPath, types.DockerUncompressedLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dockerBase, err := mutate.AppendLayers(empty.Image, baseLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ociBase := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIConfigJSON)
+
+	tests := []struct {
+		name   string
+		base   v1.Image
+		prefix string
+	}{
+		{name: "docker", base: dockerBase, prefix: "application/vnd.docker."},
+		{name: "oci", base: ociBase, prefix: "application/vnd.oci."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mediaType, err := uncompressedLayerMediaType(test.base)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			layer, err := newFileLayer(layerPath, mediaType)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			img, err := commitImage(test.base, layer, &driver.RunOptions{Entrypoint: "sh"}, "message", "author")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			manifest, err := img.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the manifest, config and layers are all docker or all OCI ones
+			mediaTypes := []types.MediaType{manifest.MediaType, manifest.Config.MediaType}
+			for _, layer := range manifest.Layers {
+				mediaTypes = append(mediaTypes, layer.MediaType)
+			}
+
+			for _, mediaType := range mediaTypes {
+				if !strings.HasPrefix(string(mediaType), test.prefix) {
+					t.Errorf("committed image has media type %s, want %s ones: %v", mediaType, test.prefix, mediaTypes)
+				}
+			}
+		})
+	}
+}
@@ -3,13 +3,11 @@ package dockerless
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
-	"github.com/google/go-containerregistry/pkg/legacy"
-	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/driver"
@@ -19,19 +17,26 @@ import (
 // If input image is not found it will be automatically pulled.
 // This function will read the oci-image manifest and properly unpack the layers in the right order to generate
 // a valid rootfs.
-// Untarring process will follow the keep-id option if specified in order to ensure no permission problems.
+// Unpacking is done inside the container's user namespace in order to ensure no permission problems.
 // Generated config will be saved inside the container's dir. This will NOT be an oci-compatible container config.
 func (p *DockerlessProvider) Create(ctx context.Context, workspaceId string, runOptions *driver.RunOptions) error {
-	image := runOptions.Image
+	imageDir := p.ImageDir(runOptions.Image)
+	containerDIR := filepath.Join(p.Config.TargetDir, "rootfs", workspaceId)
+	statusDIR := filepath.Join(p.Config.TargetDir, "status", workspaceId)
 
-	ref, err := name.ParseReference(image)
-	if err == nil {
-		image = ref.Name()
+	// the image must still be allowed by policy.json, even for existing workspaces
+	err := p.checkImagePolicy(runOptions.Image)
+	if err != nil {
+		return err
 	}
 
-	imageDir := filepath.Join(p.Config.TargetDir, "images", image)
-	containerDIR := filepath.Join(p.Config.TargetDir, "rootfs", workspaceId)
-	statusDIR := filepath.Join(p.Config.TargetDir, "status", workspaceId)
+	// the image and its extracted layers must survive a concurrent prune
+	unlock, err := p.LockStore(false)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
 
 	// save the config to file
 	configPath := filepath.Join(statusDIR, "runOptions")
@@ -53,47 +58,54 @@ func (p *DockerlessProvider) Create(ctx context.Context, workspaceId string, run
 	}
 
 	// get manifest
-	manifestFile, err := os.ReadFile(filepath.Join(imageDir, "manifest.json"))
+	manifest, err := readImageManifest(imageDir)
 	if err != nil {
 		return err
 	}
 
-	var manifest v1.Manifest
-
-	err = json.Unmarshal(manifestFile, &manifest)
+	// the workspace is pinned to the digest it was created from,
+	// the image's tag might move later on
+	digest, err := imageDigest(imageDir)
 	if err != nil {
 		return err
 	}
 
-	configFile, err := os.ReadFile(filepath.Join(imageDir, "config.json"))
+	err = os.WriteFile(filepath.Join(statusDIR, "imageDigest"), []byte(digest.String()), 0o644)
 	if err != nil {
 		return err
 	}
 
-	var layerConfig legacy.LayerConfigFile
+	imageConfig, err := readImageConfig(imageDir)
+	if err != nil {
+		return err
+	}
 
-	err = json.Unmarshal(configFile, &layerConfig)
+	command, err := containerCommand(runOptions, &imageConfig.Config)
 	if err != nil {
 		return err
 	}
 
-	p.Log.Info("preparing container rootfs")
+	// the image config is kept with the workspace, for the working
+	// directory and stop signal of the main process
+	configFile, err := os.ReadFile(filepath.Join(imageDir, "config.json"))
+	if err != nil {
+		return err
+	}
 
-	for index, layer := range manifest.Layers {
-		layerDigest := strings.Split(layer.Digest.String(), ":")[1] + ".tar.gz"
+	err = os.WriteFile(filepath.Join(statusDIR, "config.json"), configFile, 0o644)
+	if err != nil {
+		return err
+	}
 
-		p.Log.Debugf("unpacking layer %d of %d", index+1, len(manifest.Layers))
+	p.Log.Info("preparing container rootfs")
 
-		err = UntarFile(
-			workspaceId,
-			filepath.Join(imageDir, layerDigest),
-			containerDIR,
-		)
-		if err != nil {
-			return err
-		}
+	err = p.prepareRootfs(workspaceId, digest, manifest)
+	if err != nil {
+		return err
 	}
 
+	p.addVolumes(workspaceId, runOptions, &imageConfig.Config)
+
 	p.Log.Info("done")
 
 	p.Log.Debugf("preparing runoptions")
@@ -103,7 +115,7 @@ func (p *DockerlessProvider) Create(ctx context.Context, workspaceId string, run
 	}
 
 	// Merge container's default environment with the custom one
-	containerEnv := config.ListToObject(layerConfig.Config.Env)
+	containerEnv := config.ListToObject(imageConfig.Config.Env)
 	for k, v := range containerEnv {
 		if runOptions.Env[k] == "" {
 			runOptions.Env[k] = v
@@ -115,10 +127,11 @@ func (p *DockerlessProvider) Create(ctx context.Context, workspaceId string, run
 		runOptions.Env["TERM"] = "xterm"
 	}
 
-	// set entrypoint if empty
-	if runOptions.Entrypoint == "" {
-		runOptions.Entrypoint = layerConfig.Config.Cmd[0]
-		runOptions.Cmd = layerConfig.Config.Cmd[1:]
+	runOptions.Entrypoint = command[0]
+	runOptions.Cmd = command[1:]
+
+	if runOptions.User == "" {
+		runOptions.User = imageConfig.Config.User
 	}
 
 	file, err := json.MarshalIndent(runOptions, "", " ")
@@ -131,7 +144,13 @@ func (p *DockerlessProvider) Create(ctx context.Context, workspaceId string, run
 		return err
 	}
 
-	containerDetails := initializeContainerDetails(ctx, workspaceId, runOptions)
+	containerDetails := initializeContainerDetails(ctx, workspaceId, containerLabels(runOptions, &imageConfig.Config))
+
+	// record whether the image's signature was verified
+	for key, value := range signatureLabels(imageDir, digest) {
+		containerDetails.Config.Labels[key] = value
+	}
+
 	detailsPath := filepath.Join(statusDIR, "containerDetails")
 	file, err = json.MarshalIndent(containerDetails, "", " ")
 	if err != nil {
@@ -148,7 +167,51 @@ func (p *DockerlessProvider) Create(ctx context.Context, workspaceId string, run
 	return nil
 }
 
-func initializeContainerDetails(ctx context.Context, workspaceId string, runOptions *driver.RunOptions) *config.ContainerDetails {
+// prepareRootfs will prepare the rootfs of the workspace with input id from the layers
+// of input manifest, whose digest is input one: an overlayfs made of the shared extracted
+// layers when supported, else a clone of the extracted image.
+func (p *DockerlessProvider) prepareRootfs(workspaceId string, digest v1.Hash, manifest *v1.Manifest) error {
+	containerDIR := filepath.Join(p.Config.TargetDir, "rootfs", workspaceId)
+
+	layers, err := p.manifestLayers(manifest)
+	if err != nil {
+		return err
+	}
+
+	if p.overlaySupported(workspaceId, manifest) {
+		// layers are extracted once and shared, the workspace only
+		// gets its own upper directory, mounted by Enter
+		return p.prepareOverlay(workspaceId, manifest)
+	}
+
+	// the image is extracted once, workspaces get a clone of it
+	err = p.prepareBase(workspaceId, digest, layers)
+	if err != nil {
+		return err
+	}
+
+	return p.cloneInNamespace(workspaceId, digest, containerDIR)
+}
+
+// manifestLayers returns the layers of input manifest, as found in the store.
+func (p *DockerlessProvider) manifestLayers(manifest *v1.Manifest) ([]Layer, error) {
+	layers := []Layer{}
+	for _, layer := range manifest.Layers {
+		err := CheckLayerMediaType(layer.MediaType)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", layer.Digest.String(), err)
+		}
+
+		layers = append(layers, Layer{
+			Path:      p.BlobPath(layer.Digest),
+			MediaType: layer.MediaType,
+		})
+	}
+
+	return layers, nil
+}
+
+func initializeContainerDetails(ctx context.Context, workspaceId string, labels map[string]string) *config.ContainerDetails {
 	return &config.ContainerDetails{
 		ID:      workspaceId,
 		Created: time.Now().String(),
@@ -157,7 +220,28 @@ func initializeContainerDetails(ctx context.Context, workspaceId string, runOpti
 			StartedAt: "",
 		},
 		Config: config.ContainerDetailsConfig{
-			Labels: config.ListToObject(runOptions.Labels),
+			Labels: labels,
 		},
 	}
 }
+
+// unpackInNamespace will apply input layers on top of target, using the hidden
+// "unpack" command in a new user namespace for the container with input id.
+func unpackInNamespace(workspaceId, target string, layers []Layer) error {
+	args := []string{os.Args[0], "unpack", target}
+	for _, layer := range layers {
+		args = append(args, layer.String())
+	}
+
+	cmd := NamespacedCommand(workspaceId, args...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("unpacking layers: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package dockerless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+// ChangeKind is the kind of change of a path, as shown by docker diff.
+type ChangeKind string
+
+const (
+	// ChangeAdded is a path missing from the image.
+	ChangeAdded ChangeKind = "A"
+	// ChangeModified is a path of the image with a different content or metadata.
+	ChangeModified ChangeKind = "C"
+	// ChangeDeleted is a path of the image that was removed.
+	ChangeDeleted ChangeKind = "D"
+)
+
+// Change is a path of a workspace that differs from its image.
+type Change struct {
+	Path string     `json:"path"`
+	Kind ChangeKind `json:"kind"`
+}
+
+// Diff returns the paths of the workspace with input id that differ from the image
+// it was created from, sorted by path. The paths Enter creates or mounts over,
+// like /dev, /proc and /tmp, are left out.
+func (p *DockerlessProvider) Diff(ctx context.Context, workspaceId string) ([]Change, error) {
+	err := checkWorkspaceId(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, digest, err := p.workspaceManifest(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	// the workspace may be running, its namespaces are not reused
+	namespaceId := "diff-" + workspaceId
+
+	args := []string{os.Args[0], "changes"}
+
+	layers, overlay := p.workspaceLayers(workspaceId)
+	if overlay {
+		// the overlayfs upper directory only holds the workspace's changes
+		args = append(args, filepath.Join(p.OverlayDir(workspaceId), "upper"))
+		for _, dir := range p.layerDirs(layers) {
+			args = append(args, "--lower", dir)
+		}
+	} else {
+		layerFiles, err := p.manifestLayers(manifest)
+		if err != nil {
+			return nil, err
+		}
+
+		// the extracted image may have been pruned since the workspace was created
+		err = p.prepareBase(namespaceId, digest, layerFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, filepath.Join(p.Config.TargetDir, "rootfs", workspaceId), "--base", p.baseDir(digest))
+	}
+
+	cmd := NamespacedCommand(namespaceId, args...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing changes: %w", err)
+	}
+
+	changes := []Change{}
+
+	err = json.Unmarshal(out, &changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// names returns the names of the entries of the directory with input name,
+// relative to the rootfs, as seen through the lower directories.
+func (l lowerDirs) names(name string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+
+	for _, dir := range l {
+		entries, err := os.ReadDir(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if seen[entry.Name()] {
+				continue
+			}
+
+			seen[entry.Name()] = true
+
+			_, _, found := l.lookup(filepath.Join(name, entry.Name()))
+			if found {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ListChanges returns the changes recorded in changesDir, in the overlayfs upper
+// directory format, against the lower directories lower, sorted by path.
+// This is meant to be run inside the container's user namespace, see the hidden
+// "changes" command, in order to read all the files.
+func ListChanges(changesDir string, lower []string) ([]Change, error) {
+	lowers := lowerDirs(lower)
+	changes := []Change{}
+
+	err := walkChanges(changesDir, false, func(name string, info fs.FileInfo, whiteout bool) error {
+		_, _, found := lowers.lookup(name)
+
+		switch {
+		case whiteout:
+			if found {
+				changes = append(changes, Change{Path: "/" + name, Kind: ChangeDeleted})
+			}
+
+			return nil
+		case !found:
+			changes = append(changes, Change{Path: "/" + name, Kind: ChangeAdded})
+
+			return nil
+		}
+
+		changes = append(changes, Change{Path: "/" + name, Kind: ChangeModified})
+
+		// the content of the lower directories is hidden by opaque ones
+		if info.IsDir() && isOpaque(filepath.Join(changesDir, name)) {
+			for _, entry := range lowers.names(name) {
+				if !Exist(filepath.Join(changesDir, name, entry)) {
+					changes = append(changes, Change{Path: "/" + filepath.Join(name, entry), Kind: ChangeDeleted})
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
+
+// TreeChanges returns the changes of rootfs against base, sorted by path. As with
+// overlayfs, the parent directories of changed paths are changed as well.
+// This is meant to be run inside the container's user namespace, see the hidden
+// "changes" command, in order to read all the files.
+func TreeChanges(base, rootfs string) ([]Change, error) {
+	kinds := map[string]ChangeKind{}
+
+	change := func(name string, kind ChangeKind) {
+		kinds[name] = kind
+
+		for parent := filepath.Dir(name); parent != "."; parent = filepath.Dir(parent) {
+			if _, found := kinds[parent]; found {
+				break
+			}
+
+			kinds[parent] = ChangeModified
+		}
+	}
+
+	err := walkChanges(rootfs, false, func(name string, info fs.FileInfo, _ bool) error {
+		baseInfo, err := os.Lstat(filepath.Join(base, name))
+		if err != nil {
+			if !os.IsNotExist(err) && !errors.Is(err, syscall.ENOTDIR) {
+				return err
+			}
+
+			change(name, ChangeAdded)
+
+			return nil
+		}
+
+		if fileChanged(baseInfo, info) {
+			change(name, ChangeModified)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = walkChanges(base, false, func(name string, info fs.FileInfo, _ bool) error {
+		rootfsInfo, err := os.Lstat(filepath.Join(rootfs, name))
+		if err == nil {
+			// replaced by a file, already recorded
+			if info.IsDir() && !rootfsInfo.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		change(name, ChangeDeleted)
+
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for name, kind := range kinds {
+		changes = append(changes, Change{Path: "/" + name, Kind: kind})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
@@ -8,12 +8,19 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/log"
+	"golang.org/x/sys/unix"
 )
 
+// stopTimeout is how long the container's main process has to exit once signaled.
+const stopTimeout = 10 * time.Second
+
 func NewProvider(ctx context.Context, options *options.Options, logs log.Logger) (*DockerlessProvider, error) {
 	// create provider
 	provider := &DockerlessProvider{
@@ -69,6 +76,8 @@ func (p *DockerlessProvider) Find(ctx context.Context, workspaceId string) (*con
 	return &containerDetails, nil
 }
 
+// Stop will send the image's stop signal to the container's main process, and kill
+// the container if it is still running after stopTimeout.
 func (p *DockerlessProvider) Stop(ctx context.Context, workspaceId string) error {
 	p.Log.Infof("stopping: %s", workspaceId)
 
@@ -79,6 +88,37 @@ func (p *DockerlessProvider) Stop(ctx context.Context, workspaceId string) error
 
 	p.Log.Debugf("found parent process: %d", pid)
 
+	signal, err := stopSignal(p.workspaceConfig(workspaceId))
+	if err != nil {
+		return err
+	}
+
+	// the main process is the only child of the enter helper
+	children, err := exec.Command("pgrep", "-P", strconv.Itoa(pid)).Output()
+	if err == nil {
+		for _, child := range strings.Fields(string(children)) {
+			childPid, err := strconv.Atoi(child)
+			if err != nil {
+				continue
+			}
+
+			p.Log.Debugf("sending %s to process %d", unix.SignalName(signal), childPid)
+
+			_ = syscall.Kill(childPid, signal)
+		}
+
+		for deadline := time.Now().Add(stopTimeout); time.Now().Before(deadline); {
+			_, err = GetPid(workspaceId)
+			if err != nil {
+				return nil
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		p.Log.Debugf("container %s still running after %s, killing it", workspaceId, stopTimeout)
+	}
+
 	return exec.Command("kill", "-9", strconv.Itoa(pid)).Run()
 }
 
@@ -95,36 +135,6 @@ func (p *DockerlessProvider) Delete(ctx context.Context, workspaceId string) err
 		return err
 	}
 
-	command := ""
-	var args []string
-
-	if os.Getuid() > 0 {
-		command = "rootlesskit"
-		args = []string{
-			"--pidns",
-			"--cgroupns",
-			"--utsns",
-			"--ipcns",
-			"--net",
-			"host",
-			"--state-dir",
-			filepath.Join("/tmp", "dockerless", workspaceId),
-		}
-	} else {
-		command = "unshare"
-		args = []string{
-			"-m",
-			"-p",
-			"-u",
-			"-f",
-			"--mount-proc",
-		}
-	}
-
-	args = append(args, []string{
-		"rm", "-rf", containerDIR,
-	}...)
-
-	cmd := exec.Command(command, args...)
+	cmd := NamespacedCommand(workspaceId, "rm", "-rf", containerDIR, p.OverlayDir(workspaceId), p.VolumesDir(workspaceId), p.SnapshotsDir(workspaceId))
 	return cmd.Run()
 }
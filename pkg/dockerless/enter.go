@@ -29,6 +29,19 @@ func (p *DockerlessProvider) Enter(ctx context.Context, workspaceId string) erro
 		return err
 	}
 
+	layers, overlay := p.workspaceLayers(workspaceId)
+	if overlay {
+		err = p.mountOverlay(workspaceId, containerDIR, layers)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.initVolumes(workspaceId, containerDIR, runOptions.Mounts)
+	if err != nil {
+		return err
+	}
+
 	err = prepareMounts(containerDIR)
 	if err != nil {
 		return err
@@ -72,13 +85,55 @@ func (p *DockerlessProvider) Enter(ctx context.Context, workspaceId string) erro
 		return fmt.Errorf("error setting hostname for namespace: %w", err)
 	}
 
-	cmd := exec.Command(runOptions.Entrypoint, runOptions.Cmd...)
+	imageConfig := p.workspaceConfig(workspaceId)
+
+	workingDir := "/"
+	if imageConfig.WorkingDir != "" {
+		workingDir = filepath.Clean("/" + imageConfig.WorkingDir)
+	}
+
+	// as in docker, the working directory is created if missing
+	resolvedWorkingDir, err := SecureJoin(containerDIR, workingDir)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(resolvedWorkingDir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	entrypoint, err := lookPath(containerDIR, runOptions.Entrypoint, runOptions.Env["PATH"])
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(entrypoint, runOptions.Cmd...)
+	cmd.Dir = workingDir
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Chroot: containerDIR,
 	}
+
+	if runOptions.User != "" {
+		user, err := lookupUser(containerDIR, runOptions.User)
+		if err != nil {
+			return err
+		}
+
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid:    user.uid,
+			Gid:    user.gid,
+			Groups: user.groups,
+		}
+
+		if runOptions.Env["HOME"] == "" {
+			runOptions.Env["HOME"] = user.home
+		}
+	}
+
 	cmd.Env = config.ObjectToList(runOptions.Env)
 
 	return cmd.Run()
@@ -58,7 +58,13 @@ func (p *DockerlessProvider) ExecuteCommand(ctx context.Context, workspaceId, us
 	}...)
 
 	if user != "" && user != "0" && user != "root" {
-		uid := findUserPasswd(containerDIR, user)
+		// overlayfs rootfs are only mounted inside the container
+		rootfs := containerDIR
+		if _, overlay := p.workspaceLayers(workspaceId); overlay {
+			rootfs = filepath.Join("/proc", string(pid), "root")
+		}
+
+		uid := findUserPasswd(rootfs, user)
 		command = "su -l " + uid + " -c " + command
 	}
 
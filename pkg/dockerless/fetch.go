@@ -0,0 +1,85 @@
+package dockerless
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// blobFetcher downloads blobs straight from the registry, in order to resume
+// interrupted downloads using HTTP range requests.
+type blobFetcher struct {
+	repo   name.Repository
+	client *http.Client
+}
+
+func newBlobFetcher(ctx context.Context, repo name.Repository, keychain authn.Keychain, roundTripper http.RoundTripper) (*blobFetcher, error) {
+	auth, err := keychain.Resolve(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	roundTripper, err = transport.NewWithContext(
+		ctx,
+		repo.Registry,
+		auth,
+		roundTripper,
+		[]string{repo.Scope(transport.PullScope)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blobFetcher{
+		repo:   repo,
+		client: &http.Client{Transport: roundTripper},
+	}, nil
+}
+
+// fetch returns the content of the blob with input digest starting at offset.
+// If the registry does not support range requests the whole blob is returned,
+// the second return value tells whether the content starts at offset.
+func (f *blobFetcher) fetch(ctx context.Context, digest v1.Hash, offset int64) (io.ReadCloser, bool, error) {
+	url := fmt.Sprintf("%s://%s/v2/%s/blobs/%s",
+		f.repo.Scheme(),
+		f.repo.RegistryStr(),
+		f.repo.RepositoryStr(),
+		digest.String(),
+	)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := f.client.Do(request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		return response.Body, offset > 0, nil
+	case http.StatusOK:
+		return response.Body, false, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial download is not usable, start over
+		_ = response.Body.Close()
+
+		return f.fetch(ctx, digest, 0)
+	default:
+		_ = response.Body.Close()
+
+		return nil, false, fmt.Errorf("fetching blob %s: %s", digest.String(), response.Status)
+	}
+}
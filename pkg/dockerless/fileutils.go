@@ -4,64 +4,12 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"syscall"
 )
 
-// UntarFile will untar target file to target directory.
-// If userns is specified and it is keep-id, it will perform the
-// untarring in a new user namespace with user id maps set, in order to prevent
-// permission errors.
-func UntarFile(workspaceId, path, target string) error {
-	// first ensure we can write
-	err := syscall.Access(path, 2)
-	if err != nil {
-		return err
-	}
-
-	command := ""
-	var args []string
-
-	if os.Getuid() > 0 {
-		command = "rootlesskit"
-		args = []string{
-			"--pidns",
-			"--cgroupns",
-			"--utsns",
-			"--ipcns",
-			"--net",
-			"host",
-			"--state-dir",
-			filepath.Join("/tmp", "dockerless", workspaceId),
-		}
-	} else {
-		command = "unshare"
-		args = []string{
-			"-m",
-			"-p",
-			"-u",
-			"-f",
-			"--mount-proc",
-		}
-	}
-
-	args = append(args, []string{
-		"tar", "--exclude=dev/*", "-xpf", path, "-C", target,
-	}...,
-	)
-
-	cmd := exec.Command(command, args...)
-
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%w: %s", err, string(out))
-	}
-
-	return nil
-}
-
 // GetFileDigest will return the sha256sum of input file. Empty if error occurs.
 func GetFileDigest(path string) string {
 	file, err := os.Open(path)
@@ -95,6 +43,39 @@ func Exist(path string) bool {
 	return err == nil
 }
 
+// dirSize returns the size of the regular files inside input directory, hardlinks
+// being counted once. Unreadable entries are skipped.
+func dirSize(path string) int64 {
+	var size int64
+
+	inodes := map[uint64]bool{}
+
+	_ = filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			if inodes[stat.Ino] {
+				return nil
+			}
+
+			inodes[stat.Ino] = true
+		}
+
+		size += info.Size()
+
+		return nil
+	})
+
+	return size
+}
+
 // Mount will bind-mount src to dest, using input mode.
 func Mount(src, dest string, mode uintptr) error {
 	info, err := os.Stat(src)
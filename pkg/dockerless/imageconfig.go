@@ -0,0 +1,350 @@
+package dockerless
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/driver"
+	"golang.org/x/sys/unix"
+)
+
+// defaultStopSignal is sent to the container's main process when the image sets none.
+const defaultStopSignal = syscall.SIGTERM
+
+// processUser is the user the container's main process runs as.
+type processUser struct {
+	uid    uint32
+	gid    uint32
+	groups []uint32
+	home   string
+}
+
+// workspaceConfig returns the config of the image the workspace with input id was
+// created from, empty for workspaces created before it was kept.
+func (p *DockerlessProvider) workspaceConfig(workspaceId string) *v1.Config {
+	imageConfig, err := readImageConfig(filepath.Join(p.Config.TargetDir, "status", workspaceId))
+	if err != nil {
+		return &v1.Config{}
+	}
+
+	return &imageConfig.Config
+}
+
+// containerCommand returns the command line of the container's main process,
+// following docker: the image entrypoint is replaced by the one of the run options,
+// which also drops the image cmd, and the image cmd by the one of the run options.
+func containerCommand(runOptions *driver.RunOptions, imageConfig *v1.Config) ([]string, error) {
+	entrypoint := imageConfig.Entrypoint
+	cmd := imageConfig.Cmd
+
+	if runOptions.Entrypoint != "" {
+		entrypoint = []string{runOptions.Entrypoint}
+		cmd = nil
+	}
+
+	if len(runOptions.Cmd) > 0 {
+		cmd = runOptions.Cmd
+	}
+
+	command := append(append([]string{}, entrypoint...), cmd...)
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command specified, the image has neither an entrypoint nor a cmd")
+	}
+
+	return command, nil
+}
+
+// containerLabels returns the labels of the container, the image's ones
+// being overridden by the ones of the run options.
+func containerLabels(runOptions *driver.RunOptions, imageConfig *v1.Config) map[string]string {
+	labels := map[string]string{}
+	for key, value := range imageConfig.Labels {
+		labels[key] = value
+	}
+
+	for key, value := range config.ListToObject(runOptions.Labels) {
+		labels[key] = value
+	}
+
+	return labels
+}
+
+// VolumesDir returns the directory holding the anonymous volumes of the workspace with input id.
+func (p *DockerlessProvider) VolumesDir(workspaceId string) string {
+	return filepath.Join(p.Config.TargetDir, "volumes", workspaceId)
+}
+
+// addVolumes will add an anonymous volume to the run options' mounts for each of the
+// volumes declared by the image, not already mounted by the run options.
+// Volumes are created by Enter, see initVolumes.
+func (p *DockerlessProvider) addVolumes(workspaceId string, runOptions *driver.RunOptions, imageConfig *v1.Config) {
+	mounted := map[string]bool{}
+	for _, mount := range runOptions.Mounts {
+		mounted[filepath.Clean("/"+mount.Target)] = true
+	}
+
+	if runOptions.WorkspaceMount != nil {
+		mounted[filepath.Clean("/"+runOptions.WorkspaceMount.Target)] = true
+	}
+
+	targets := []string{}
+	for target := range imageConfig.Volumes {
+		target = filepath.Clean("/" + target)
+		if !mounted[target] {
+			targets = append(targets, target)
+		}
+	}
+
+	sort.Strings(targets)
+
+	for index, target := range targets {
+		runOptions.Mounts = append(runOptions.Mounts, &config.Mount{
+			Source: filepath.Join(p.VolumesDir(workspaceId), strconv.Itoa(index)),
+			Target: target,
+			Type:   "bind",
+		})
+	}
+}
+
+// initVolumes will create the anonymous volumes of the workspace with input id found in
+// mounts, and point them to where their target resolves inside the rootfs. As in docker,
+// volumes are initialized with the content of the image at their path.
+// This is meant to be run inside the container's user namespace, once the rootfs is
+// mounted, in order to keep the ownership of the files.
+func (p *DockerlessProvider) initVolumes(workspaceId, rootfs string, mounts []*config.Mount) error {
+	for _, mount := range mounts {
+		if filepath.Dir(mount.Source) != p.VolumesDir(workspaceId) {
+			continue
+		}
+
+		resolved, err := SecureJoin(rootfs, mount.Target)
+		if err != nil {
+			return fmt.Errorf("volume %s: %w", mount.Target, err)
+		}
+
+		mount.Target = strings.TrimPrefix(resolved, rootfs)
+
+		if Exist(mount.Source) {
+			continue
+		}
+
+		// initialized aside then renamed, so that partial volumes are never used
+		tempDir := mount.Source + ".init"
+
+		err = os.RemoveAll(tempDir)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(tempDir, 0o755)
+		if err != nil {
+			return err
+		}
+
+		if Exist(resolved) {
+			output, err := exec.Command("cp", "-a", resolved+"/.", tempDir).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("initializing volume %s: %w: %s", mount.Target, err, strings.TrimSpace(string(output)))
+			}
+		}
+
+		err = os.Rename(tempDir, mount.Source)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stopSignal returns the signal stopping the container's main process, as set
+// by the image, eg SIGQUIT, QUIT or 3.
+func stopSignal(imageConfig *v1.Config) (syscall.Signal, error) {
+	if imageConfig.StopSignal == "" {
+		return defaultStopSignal, nil
+	}
+
+	number, err := strconv.Atoi(imageConfig.StopSignal)
+	if err == nil {
+		return syscall.Signal(number), nil
+	}
+
+	name := strings.ToUpper(imageConfig.StopSignal)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	signal := unix.SignalNum(name)
+	if signal == 0 {
+		return 0, fmt.Errorf("invalid stop signal %s", imageConfig.StopSignal)
+	}
+
+	return signal, nil
+}
+
+// lookPath returns the path of the executable file inside the rootfs, searching the
+// directories of input PATH when file has no slash, as the container would.
+func lookPath(rootfs, file, path string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		candidate := filepath.Join("/", dir, file)
+
+		resolved, err := SecureJoin(rootfs, candidate)
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Stat(resolved)
+		if err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0 {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("executable file %s not found in $PATH", file)
+}
+
+// lookupUser returns the user to run as, for a user spec as found in the image config,
+// eg user, uid, user:group or uid:gid. Names are looked up in the rootfs'
+// /etc/passwd and /etc/group.
+func lookupUser(rootfs, spec string) (*processUser, error) {
+	userName, groupName, hasGroup := strings.Cut(spec, ":")
+
+	user := &processUser{home: "/"}
+	found := false
+
+	err := readColonFile(rootfs, "/etc/passwd", func(fields []string) bool {
+		if len(fields) < 6 || (fields[0] != userName && fields[2] != userName) {
+			return false
+		}
+
+		uid, uidErr := strconv.ParseUint(fields[2], 10, 32)
+		gid, gidErr := strconv.ParseUint(fields[3], 10, 32)
+		if uidErr != nil || gidErr != nil {
+			return false
+		}
+
+		user.uid, user.gid, user.home = uint32(uid), uint32(gid), fields[5]
+		userName = fields[0]
+		found = true
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		uid, err := strconv.ParseUint(userName, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("user %s not found in /etc/passwd", userName)
+		}
+
+		// as in docker, unknown users belong to the root group
+		user.uid, user.gid = uint32(uid), 0
+	}
+
+	if hasGroup {
+		found = false
+
+		err = readColonFile(rootfs, "/etc/group", func(fields []string) bool {
+			if len(fields) < 3 || (fields[0] != groupName && fields[2] != groupName) {
+				return false
+			}
+
+			gid, err := strconv.ParseUint(fields[2], 10, 32)
+			if err != nil {
+				return false
+			}
+
+			user.gid = uint32(gid)
+			found = true
+
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			gid, err := strconv.ParseUint(groupName, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("group %s not found in /etc/group", groupName)
+			}
+
+			user.gid = uint32(gid)
+		}
+
+		return user, nil
+	}
+
+	// supplementary groups only apply without an explicit group
+	err = readColonFile(rootfs, "/etc/group", func(fields []string) bool {
+		if len(fields) < 4 {
+			return false
+		}
+
+		for _, member := range strings.Split(fields[3], ",") {
+			if member != userName {
+				continue
+			}
+
+			gid, err := strconv.ParseUint(fields[2], 10, 32)
+			if err == nil {
+				user.groups = append(user.groups, uint32(gid))
+			}
+		}
+
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// readColonFile will call input function with the fields of each entry of a
+// passwd-like file of the rootfs, until it returns true. Missing files are ignored.
+func readColonFile(rootfs, path string, entry func(fields []string) bool) error {
+	resolved, err := SecureJoin(rootfs, path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(resolved)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if entry(strings.Split(line, ":")) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,205 @@
+package dockerless
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/log"
+)
+
+func TestStopSignal(t *testing.T) {
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir()},
+		Log:    log.Discard,
+	}
+
+	tests := []struct {
+		stopSignal string
+		want       syscall.Signal
+		wantErr    bool
+	}{
+		{want: syscall.SIGTERM},
+		{stopSignal: "SIGQUIT", want: syscall.SIGQUIT},
+		{stopSignal: "quit", want: syscall.SIGQUIT},
+		{stopSignal: "9", want: syscall.SIGKILL},
+		{stopSignal: "SIGNOPE", wantErr: true},
+	}
+
+	for index, test := range tests {
+		workspaceId := "ws" + string(rune('a'+index))
+		statusDir := filepath.Join(provider.Config.TargetDir, "status", workspaceId)
+
+		err := os.MkdirAll(statusDir, 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		configBytes, err := json.Marshal(&v1.ConfigFile{Config: v1.Config{StopSignal: test.stopSignal}})
+		if err == nil {
+			err = os.WriteFile(filepath.Join(statusDir, "config.json"), configBytes, 0o644)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Stop reads the signal from the config kept with the workspace
+		signal, err := stopSignal(provider.workspaceConfig(workspaceId))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("stopSignal(%q) = %s, want an error", test.stopSignal, signal)
+			}
+
+			continue
+		}
+
+		if err != nil || signal != test.want {
+			t.Errorf("stopSignal(%q) = %s, %v, want %s", test.stopSignal, signal, err, test.want)
+		}
+	}
+
+	// workspaces created before the config was kept use the default
+	signal, err := stopSignal(provider.workspaceConfig("missing"))
+	if err != nil || signal != defaultStopSignal {
+		t.Errorf("stopSignal() without a config = %s, %v, want %s", signal, err, defaultStopSignal)
+	}
+}
+
+func TestContainerCommand(t *testing.T) {
+	imageConfig := &v1.Config{Entrypoint: []string{"/entrypoint.sh", "-v"}, Cmd: []string{"serve", "--port", "80"}}
+
+	tests := []struct {
+		name        string
+		runOptions  driver.RunOptions
+		imageConfig *v1.Config
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:        "image entrypoint and cmd",
+			imageConfig: imageConfig,
+			want:        []string{"/entrypoint.sh", "-v", "serve", "--port", "80"},
+		},
+		{
+			name:        "cmd replaced",
+			runOptions:  driver.RunOptions{Cmd: []string{"shell"}},
+			imageConfig: imageConfig,
+			want:        []string{"/entrypoint.sh", "-v", "shell"},
+		},
+		{
+			name:        "entrypoint replaced drops the image cmd",
+			runOptions:  driver.RunOptions{Entrypoint: "sleep"},
+			imageConfig: imageConfig,
+			want:        []string{"sleep"},
+		},
+		{
+			name:        "entrypoint and cmd replaced",
+			runOptions:  driver.RunOptions{Entrypoint: "sleep", Cmd: []string{"infinity"}},
+			imageConfig: imageConfig,
+			want:        []string{"sleep", "infinity"},
+		},
+		{
+			name:        "cmd only",
+			imageConfig: &v1.Config{Cmd: []string{"/bin/sh"}},
+			want:        []string{"/bin/sh"},
+		},
+		{
+			name:        "no command",
+			imageConfig: &v1.Config{},
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		runOptions := test.runOptions
+
+		got, err := containerCommand(&runOptions, test.imageConfig)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: containerCommand() = %v, want an error", test.name, got)
+			}
+
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: containerCommand() = %v, %v, want %v", test.name, got, err, test.want)
+		}
+	}
+
+	// the image config is left untouched
+	if !reflect.DeepEqual(imageConfig.Cmd, []string{"serve", "--port", "80"}) {
+		t.Errorf("containerCommand() changed the image cmd to %v", imageConfig.Cmd)
+	}
+}
+
+func TestLookupUser(t *testing.T) {
+	rootfs := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passwd := `root:x:0:0:root:/root:/bin/sh
+# a comment
+dev:x:1000:1000:developer:/home/dev:/bin/bash
+broken:x:notanumber:1000::/:/bin/sh
+`
+	group := `root:x:0:
+dev:x:1000:
+docker:x:999:dev,other
+wheel:x:10:dev
+staff:x:50:other
+`
+
+	err = os.WriteFile(filepath.Join(rootfs, "etc", "passwd"), []byte(passwd), 0o644)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(rootfs, "etc", "group"), []byte(group), 0o644)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec    string
+		want    processUser
+		wantErr bool
+	}{
+		{spec: "root", want: processUser{uid: 0, gid: 0, home: "/root"}},
+		{spec: "dev", want: processUser{uid: 1000, gid: 1000, groups: []uint32{999, 10}, home: "/home/dev"}},
+		{spec: "1000", want: processUser{uid: 1000, gid: 1000, groups: []uint32{999, 10}, home: "/home/dev"}},
+		{spec: "dev:docker", want: processUser{uid: 1000, gid: 999, home: "/home/dev"}},
+		{spec: "dev:50", want: processUser{uid: 1000, gid: 50, home: "/home/dev"}},
+		{spec: "1000:999", want: processUser{uid: 1000, gid: 999, home: "/home/dev"}},
+		// unknown uids and gids are used as is
+		{spec: "4242", want: processUser{uid: 4242, gid: 0, home: "/"}},
+		{spec: "4242:4343", want: processUser{uid: 4242, gid: 4343, home: "/"}},
+		{spec: "nobody", wantErr: true},
+		{spec: "broken", wantErr: true},
+		{spec: "dev:nogroup", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := lookupUser(rootfs, test.spec)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("lookupUser(%q) = %+v, want an error", test.spec, got)
+			}
+
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("lookupUser(%q) = %+v, %v, want %+v", test.spec, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package dockerless
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/loft-sh/devpod/pkg/driver"
+)
+
+// ImageDir returns the directory holding manifest.json, config.json and
+// image_name for input image reference.
+func (p *DockerlessProvider) ImageDir(image string) string {
+	return filepath.Join(p.Config.TargetDir, "images", p.storedName(image))
+}
+
+// storedName returns the fully qualified name input image reference is stored with.
+// Unqualified names are looked up in the local registry first, then resolved as
+// usual, eg myimg:v1 -> dockerless.local/myimg:v1 once committed or tagged,
+// else index.docker.io/library/myimg:v1
+func (p *DockerlessProvider) storedName(image string) string {
+	if parseImportReference(image) == nil && isUnqualified(image) {
+		ref, err := localImageName(image)
+		if err == nil && Exist(filepath.Join(p.Config.TargetDir, "images", ref.Name(), "manifest.json")) {
+			return ref.Name()
+		}
+	}
+
+	return imageName(image)
+}
+
+// removeImageDir will remove the directory of input image, and its parents
+// left empty, eg the registry's one.
+func (p *DockerlessProvider) removeImageDir(image string) error {
+	imagesDIR := filepath.Join(p.Config.TargetDir, "images")
+
+	err := os.RemoveAll(p.ImageDir(image))
+	if err != nil {
+		return err
+	}
+
+	for dir := filepath.Dir(p.ImageDir(image)); dir != imagesDIR && strings.HasPrefix(dir, imagesDIR); dir = filepath.Dir(dir) {
+		// this only succeeds on empty directories
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// imageName returns the fully qualified name of input image reference,
+// eg alpine:latest -> index.docker.io/library/alpine:latest
+// Imported images are named after where they are imported from.
+func imageName(image string) string {
+	imported := parseImportReference(image)
+	if imported != nil {
+		return imported.localName()
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return image
+	}
+
+	return ref.Name()
+}
+
+// localImageName returns the name images created locally are stored with, by commit
+// or tag. Unqualified names belong to the local registry instead of docker.io,
+// eg myimg:v1 -> dockerless.local/myimg:v1
+func localImageName(image string) (name.Reference, error) {
+	if isUnqualified(image) {
+		image = LocalRegistry + "/" + image
+	}
+
+	return name.ParseReference(image)
+}
+
+// isLocalImage returns whether input reference names an image of the local registry,
+// which only exists in the store.
+func isLocalImage(ref name.Reference) bool {
+	return ref.Context().RegistryStr() == LocalRegistry
+}
+
+// ListImages returns the fully qualified names of all the stored images.
+func (p *DockerlessProvider) ListImages() ([]string, error) {
+	imagesDIR := filepath.Join(p.Config.TargetDir, "images")
+	images := []string{}
+
+	err := filepath.WalkDir(imagesDIR, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if entry.IsDir() || entry.Name() != "image_name" {
+			return nil
+		}
+
+		image, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		images = append(images, string(image))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(images)
+
+	return images, nil
+}
+
+// WorkspaceImages returns, for each image used by an existing workspace,
+// the ids of the workspaces using it.
+func (p *DockerlessProvider) WorkspaceImages() (map[string][]string, error) {
+	statusDIR := filepath.Join(p.Config.TargetDir, "status")
+	images := map[string][]string{}
+
+	workspaces, err := os.ReadDir(statusDIR)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return images, nil
+		}
+
+		return nil, err
+	}
+
+	for _, workspace := range workspaces {
+		runOptionsBytes, err := os.ReadFile(filepath.Join(statusDIR, workspace.Name(), "runOptions"))
+		if err != nil {
+			continue
+		}
+
+		runOptions := driver.RunOptions{}
+
+		err = json.Unmarshal(runOptionsBytes, &runOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		image := imageName(runOptions.Image)
+		images[image] = append(images[image], workspace.Name())
+	}
+
+	return images, nil
+}
+
+// WorkspaceDigests returns the digests of the image manifests existing
+// workspaces, and their snapshots, were created from.
+func (p *DockerlessProvider) WorkspaceDigests() (map[string]bool, error) {
+	statusDIR := filepath.Join(p.Config.TargetDir, "status")
+	digests := map[string]bool{}
+
+	workspaces, err := os.ReadDir(statusDIR)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return digests, nil
+		}
+
+		return nil, err
+	}
+
+	for _, workspace := range workspaces {
+		digest, err := os.ReadFile(filepath.Join(statusDIR, workspace.Name(), "imageDigest"))
+		if err != nil {
+			continue
+		}
+
+		digests[strings.TrimSpace(string(digest))] = true
+	}
+
+	// a workspace may have been rebased since its snapshots were created
+	snapshots, err := p.ListSnapshots("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range snapshots {
+		digest, err := os.ReadFile(filepath.Join(p.SnapshotsDir(snapshot.Workspace), snapshot.Name, "status", "imageDigest"))
+		if err != nil {
+			continue
+		}
+
+		digests[strings.TrimSpace(string(digest))] = true
+	}
+
+	return digests, nil
+}
@@ -0,0 +1,111 @@
+package dockerless
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/log"
+)
+
+func TestLocalImageName(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "myimg", want: "dockerless.local/myimg:latest"},
+		{image: "myimg:v1", want: "dockerless.local/myimg:v1"},
+		{image: "team/myimg:v1", want: "dockerless.local/team/myimg:v1"},
+		{image: "dockerless.local/myimg:v1", want: "dockerless.local/myimg:v1"},
+		{image: "my.registry/base:latest", want: "my.registry/base:latest"},
+		{image: "localhost:5000/base", want: "localhost:5000/base:latest"},
+	}
+
+	for _, test := range tests {
+		ref, err := localImageName(test.image)
+		if err != nil {
+			t.Errorf("localImageName(%q) error = %v", test.image, err)
+
+			continue
+		}
+
+		if ref.Name() != test.want {
+			t.Errorf("localImageName(%q) = %q, want %q", test.image, ref.Name(), test.want)
+		}
+	}
+}
+
+func TestPullLocalImage(t *testing.T) {
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir(), PullPolicy: options.PullPolicyAlways},
+		Log:    log.Discard,
+	}
+
+	// images of the local registry are not looked up remotely
+	err := provider.Pull(context.Background(), &driver.RunOptions{Image: "dockerless.local/myimg:v1"})
+	if err == nil || !strings.Contains(err.Error(), "only created by commit and tag") {
+		t.Errorf("Pull() error = %v, want the image not to be pulled", err)
+	}
+}
+
+func TestLocalImageLookups(t *testing.T) {
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir(), PullPolicy: options.PullPolicyAlways},
+		Log:    log.Discard,
+	}
+
+	err := provider.saveImage(context.Background(), "registry.example.com/app:1", testImage(t, 0), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = provider.TagImage("registry.example.com/app:1", "myimg:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inspect, err := provider.InspectImage("myimg:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inspect.Name != "dockerless.local/myimg:v1" {
+		t.Errorf("InspectImage(myimg:v1) = %s, want dockerless.local/myimg:v1", inspect.Name)
+	}
+
+	// unqualified names not stored locally are still docker.io ones
+	_, err = provider.InspectImage("other:v1")
+	if err == nil || !strings.Contains(err.Error(), "index.docker.io/library/other:v1") {
+		t.Errorf("InspectImage(other:v1) error = %v, want a docker.io image", err)
+	}
+
+	err = provider.SaveImages(context.Background(), []string{"myimg:v1"}, SaveFormatOCI, filepath.Join(t.TempDir(), "layout"))
+	if err != nil {
+		t.Errorf("SaveImages(myimg:v1) error = %v", err)
+	}
+
+	// the local image is used without looking up a registry
+	runOptions := &driver.RunOptions{Image: "myimg:v1"}
+
+	err = provider.Pull(context.Background(), runOptions)
+	if err != nil {
+		t.Errorf("Pull(myimg:v1) error = %v", err)
+	}
+
+	if runOptions.Image != "dockerless.local/myimg:v1" {
+		t.Errorf("Pull(myimg:v1) image = %s, want dockerless.local/myimg:v1", runOptions.Image)
+	}
+
+	err = provider.RemoveImage("myimg:v1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.InspectImage("dockerless.local/myimg:v1")
+	if err == nil {
+		t.Errorf("InspectImage(dockerless.local/myimg:v1) found a removed image")
+	}
+}
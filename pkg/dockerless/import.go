@@ -0,0 +1,296 @@
+package dockerless
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// TransportOCI imports images from an OCI image layout, oci:/path[:reference]
+	TransportOCI = "oci"
+	// TransportDockerArchive imports images from a docker save tarball, docker-archive:/path.tar[:reference]
+	TransportDockerArchive = "docker-archive"
+	// TransportDir imports a plain rootfs directory as a single layer image, dir:/path
+	TransportDir = "dir"
+
+	// LocalRegistry is the registry part of the name of images that do not come from a registry
+	LocalRegistry = "dockerless.local"
+)
+
+// invalidRepositoryChars matches what cannot be part of an image repository.
+var invalidRepositoryChars = regexp.MustCompile(`[^a-z0-9._/-]+`)
+
+// invalidTagChars matches what cannot be part of an image tag.
+var invalidTagChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// importReference is an image imported from the local filesystem
+// instead of being pulled from a registry.
+type importReference struct {
+	transport string
+	path      string
+	reference string
+}
+
+// parseImportReference returns the image to import for images with a transport
+// prefix, like oci:/path:tag, nil for registry references.
+// Paths must be absolute or start with ./ or ../, so that registries named like a
+// transport, eg oci:5000/team/image, are not mistaken for one.
+func parseImportReference(image string) *importReference {
+	transport, rest, ok := strings.Cut(image, ":")
+	if !ok {
+		return nil
+	}
+
+	imported := &importReference{transport: transport, path: rest}
+
+	switch transport {
+	case TransportOCI, TransportDockerArchive:
+		// as in containers, references may hold colons, paths may not
+		imported.path, imported.reference, _ = strings.Cut(rest, ":")
+	case TransportDir:
+	default:
+		return nil
+	}
+
+	if !isImportPath(imported.path) {
+		return nil
+	}
+
+	path, err := filepath.Abs(imported.path)
+	if err == nil {
+		imported.path = path
+	}
+
+	return imported
+}
+
+// isImportPath returns whether input path is absolute or explicitly relative.
+func isImportPath(path string) bool {
+	for _, prefix := range []string{"/", "./", "../"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return path == "." || path == ".."
+}
+
+// String returns the image in the transport:path[:reference] form.
+func (i *importReference) String() string {
+	if i.reference == "" {
+		return i.transport + ":" + i.path
+	}
+
+	return i.transport + ":" + i.path + ":" + i.reference
+}
+
+// localName returns the name imported images are stored with,
+// eg oci:/srv/images/base:1.0 -> dockerless.local/oci/srv/images/base:1.0
+func (i *importReference) localName() string {
+	repository := strings.ToLower(strings.TrimPrefix(i.path, "/"))
+	repository = invalidRepositoryChars.ReplaceAllString(repository, "-")
+
+	tag := "latest"
+	if i.reference != "" {
+		tag = invalidTagChars.ReplaceAllString(i.reference, "-")
+	}
+
+	return LocalRegistry + "/" + i.transport + "/" + repository + ":" + tag
+}
+
+// scopes returns the scopes of the policy.json transport matching the image,
+// from the most specific: the image, its path then each parent directory.
+func (i *importReference) scopes() []string {
+	scopes := []string{}
+	if i.reference != "" {
+		scopes = append(scopes, i.path+":"+i.reference)
+	}
+
+	for dir := i.path; ; dir = filepath.Dir(dir) {
+		scopes = append(scopes, dir)
+
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	return scopes
+}
+
+// image returns the image to import for input platform. For the dir transport the
+// layer is written as a tarball in tempDir, that should be removed once done.
+func (i *importReference) image(platform *v1.Platform, tempDir string) (v1.Image, error) {
+	var (
+		img v1.Image
+		err error
+	)
+
+	switch i.transport {
+	case TransportOCI:
+		img, err = ociImage(i.path, i.reference, platform)
+	case TransportDockerArchive:
+		img, err = dockerArchiveImage(i.path, i.reference)
+	case TransportDir:
+		img, err = rootfsImage(i.path, platform, tempDir)
+	default:
+		return nil, fmt.Errorf("unknown transport %s", i.transport)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("importing %s: %w", i.String(), err)
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("importing %s: %w", i.String(), err)
+	}
+
+	if configFile.Platform() == nil || !configFile.Platform().Satisfies(*platform) {
+		return nil, fmt.Errorf("importing %s: image is not for platform %s", i.String(), platform.String())
+	}
+
+	return img, nil
+}
+
+// checkImportPolicy returns an error if input imported image is not allowed by the policy.json in use.
+func (p *DockerlessProvider) checkImportPolicy(imported *importReference) error {
+	return p.checkPolicy(imported.transport, imported.scopes(), imported.String(), false)
+}
+
+// ociImage returns the image with input reference in the OCI image layout at path, as
+// found in the org.opencontainers.image.ref.name annotation. Without reference, the
+// layout must hold a single image.
+// Multi-platform images are resolved to input platform.
+func ociImage(path, reference string, platform *v1.Platform) (v1.Image, error) {
+	index, err := layout.ImageIndexFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	found := []v1.Descriptor{}
+
+	for _, desc := range indexManifest.Manifests {
+		if reference == "" || desc.Annotations[refNameAnnotation] == reference {
+			found = append(found, desc)
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no image %q found", reference)
+	}
+
+	if len(found) > 1 {
+		return nil, fmt.Errorf("the layout holds %d images, select one with %s:%s:<reference>", len(found), TransportOCI, path)
+	}
+
+	if !found[0].MediaType.IsIndex() {
+		return index.Image(found[0].Digest)
+	}
+
+	platformIndex, err := index.ImageIndex(found[0].Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	platformManifest, err := platformIndex.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, desc := range platformManifest.Manifests {
+		if desc.Platform != nil && desc.Platform.Satisfies(*platform) {
+			return platformIndex.Image(desc.Digest)
+		}
+	}
+
+	return nil, fmt.Errorf("no image for platform %s found", platform.String())
+}
+
+// dockerArchiveImage returns the image with input reference in the docker save tarball at path.
+// Without reference, the tarball must hold a single image.
+func dockerArchiveImage(path, reference string) (v1.Image, error) {
+	var tag *name.Tag
+
+	if reference != "" {
+		parsed, err := name.NewTag(reference)
+		if err != nil {
+			return nil, err
+		}
+
+		tag = &parsed
+	}
+
+	return tarball.Image(func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}, tag)
+}
+
+// rootfsImage returns a single layer image for input platform, holding the
+// rootfs directory at path. The layer is written as a tarball in tempDir.
+func rootfsImage(path string, platform *v1.Platform, tempDir string) (v1.Image, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+
+	layerFile, err := os.CreateTemp(tempDir, "rootfs-*.tar")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = layerFile.Close() }()
+
+	err = WriteTar(path, layerFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = layerFile.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	layer, err := newFileLayer(layerFile.Name(), types.OCIUncompressedLayer)
+	if err != nil {
+		return nil, err
+	}
+
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+
+	img, err = mutate.ConfigFile(img, &v1.ConfigFile{
+		Architecture: platform.Architecture,
+		OS:           platform.OS,
+		Variant:      platform.Variant,
+		Config: v1.Config{
+			Env: []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+			Cmd: []string{"/bin/sh"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mutate.AppendLayers(img, layer)
+}
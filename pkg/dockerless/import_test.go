@@ -0,0 +1,74 @@
+package dockerless
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseImportReference(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		image string
+		want  *importReference
+	}{
+		{image: "oci:/srv/layout", want: &importReference{transport: TransportOCI, path: "/srv/layout"}},
+		{image: "oci:/srv/layout:1.0", want: &importReference{transport: TransportOCI, path: "/srv/layout", reference: "1.0"}},
+		{
+			image: "oci:/srv/layout:docker.io/library/alpine:3.19",
+			want:  &importReference{transport: TransportOCI, path: "/srv/layout", reference: "docker.io/library/alpine:3.19"},
+		},
+		{image: "oci:./layout", want: &importReference{transport: TransportOCI, path: filepath.Join(cwd, "layout")}},
+		{image: "oci:.:v1", want: &importReference{transport: TransportOCI, path: cwd, reference: "v1"}},
+		{
+			image: "docker-archive:../image.tar:app:v1",
+			want:  &importReference{transport: TransportDockerArchive, path: filepath.Join(filepath.Dir(cwd), "image.tar"), reference: "app:v1"},
+		},
+		{image: "dir:/srv/rootfs", want: &importReference{transport: TransportDir, path: "/srv/rootfs"}},
+		{image: "dir:/srv/root:fs", want: &importReference{transport: TransportDir, path: "/srv/root:fs"}},
+		{image: "dir:/srv/rootfs/../other", want: &importReference{transport: TransportDir, path: "/srv/other"}},
+
+		// registry references
+		{image: "alpine"},
+		{image: "alpine:3.19"},
+		{image: "localhost:5000/app:v1"},
+		{image: "oci:5000/team/img"},
+		{image: "oci:5000/team/img:v1"},
+		{image: "dir:5000/team/img"},
+		{image: "docker-archive:443/img@sha256:0000000000000000000000000000000000000000000000000000000000000000"},
+		{image: "oci:latest"},
+		{image: "oci:"},
+		{image: "docker://alpine"},
+	}
+
+	for _, test := range tests {
+		got := parseImportReference(test.image)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseImportReference(%q) = %+v, want %+v", test.image, got, test.want)
+		}
+	}
+}
+
+func TestImportReferenceLocalName(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "oci:/srv/images/base:1.0", want: "dockerless.local/oci/srv/images/base:1.0"},
+		{image: "oci:/srv/Images/My Base", want: "dockerless.local/oci/srv/images/my-base:latest"},
+		{image: "docker-archive:/tmp/app.tar:app:v1", want: "dockerless.local/docker-archive/tmp/app.tar:app-v1"},
+		{image: "dir:/srv/rootfs", want: "dockerless.local/dir/srv/rootfs:latest"},
+	}
+
+	for _, test := range tests {
+		got := parseImportReference(test.image).localName()
+		if got != test.want {
+			t.Errorf("localName(%q) = %q, want %q", test.image, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package dockerless
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ImageSummary is a stored image, as listed by the images command.
+type ImageSummary struct {
+	Name    string    `json:"name"`
+	Digest  string    `json:"digest"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// ImageInspect is the detailed description of a stored image.
+type ImageInspect struct {
+	Name       string                 `json:"name"`
+	Digest     string                 `json:"digest"`
+	Size       int64                  `json:"size"`
+	Manifest   *v1.Manifest           `json:"manifest"`
+	Config     *v1.ConfigFile         `json:"config"`
+	Layers     []ImageLayer           `json:"layers"`
+	Signature  *SignatureVerification `json:"signature,omitempty"`
+	Workspaces []string               `json:"workspaces"`
+}
+
+// ImageLayer is a layer of a stored image, with the history entry that created it.
+type ImageLayer struct {
+	Digest    string          `json:"digest"`
+	DiffID    string          `json:"diffID,omitempty"`
+	MediaType types.MediaType `json:"mediaType"`
+	Size      int64           `json:"size"`
+	Created   time.Time       `json:"created"`
+	CreatedBy string          `json:"createdBy,omitempty"`
+	Comment   string          `json:"comment,omitempty"`
+}
+
+// ImageSummaries returns the summary of all the stored images, sorted by name.
+// The size is the one of the image's compressed layers and config, shared
+// layers being counted in each image.
+func (p *DockerlessProvider) ImageSummaries() ([]ImageSummary, error) {
+	images, err := p.ListImages()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []ImageSummary{}
+
+	for _, image := range images {
+		imageDir := p.ImageDir(image)
+
+		manifest, err := readImageManifest(imageDir)
+		if err != nil {
+			p.Log.Debugf("skipping image %s: %v", image, err)
+
+			continue
+		}
+
+		digest, err := imageDigest(imageDir)
+		if err != nil {
+			return nil, err
+		}
+
+		summary := ImageSummary{
+			Name:   image,
+			Digest: digest.String(),
+			Size:   manifestSize(manifest),
+		}
+
+		config, err := readImageConfig(imageDir)
+		if err == nil {
+			summary.Created = config.Created.Time
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+
+	return summaries, nil
+}
+
+// InspectImage returns the manifest, config and layer history of the stored image with input name.
+func (p *DockerlessProvider) InspectImage(image string) (*ImageInspect, error) {
+	imageDir := p.ImageDir(image)
+
+	manifest, err := readImageManifest(imageDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("image %s not found", p.storedName(image))
+		}
+
+		return nil, err
+	}
+
+	config, err := readImageConfig(imageDir)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := imageDigest(imageDir)
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := p.WorkspaceImages()
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces := used[p.storedName(image)]
+	if workspaces == nil {
+		workspaces = []string{}
+	}
+
+	var signature *SignatureVerification
+	if isVerified(imageDir, digest) {
+		signature = readSignatureVerification(imageDir)
+	}
+
+	return &ImageInspect{
+		Name:       p.storedName(image),
+		Digest:     digest.String(),
+		Size:       manifestSize(manifest),
+		Manifest:   manifest,
+		Config:     config,
+		Layers:     imageLayers(manifest, config),
+		Signature:  signature,
+		Workspaces: workspaces,
+	}, nil
+}
+
+// imageLayers returns the layers of input manifest, matched with the history
+// entries of the config, skipping the ones that created no layer.
+func imageLayers(manifest *v1.Manifest, config *v1.ConfigFile) []ImageLayer {
+	history := []v1.History{}
+	for _, entry := range config.History {
+		if !entry.EmptyLayer {
+			history = append(history, entry)
+		}
+	}
+
+	layers := []ImageLayer{}
+
+	for index, desc := range manifest.Layers {
+		layer := ImageLayer{
+			Digest:    desc.Digest.String(),
+			MediaType: desc.MediaType,
+			Size:      desc.Size,
+		}
+
+		if index < len(config.RootFS.DiffIDs) {
+			layer.DiffID = config.RootFS.DiffIDs[index].String()
+		}
+
+		if index < len(history) {
+			layer.Created = history[index].Created.Time
+			layer.CreatedBy = history[index].CreatedBy
+			layer.Comment = history[index].Comment
+		}
+
+		layers = append(layers, layer)
+	}
+
+	return layers
+}
+
+// manifestSize returns the size of the config and layers of input manifest.
+func manifestSize(manifest *v1.Manifest) int64 {
+	size := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+
+	return size
+}
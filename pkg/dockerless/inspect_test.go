@@ -0,0 +1,119 @@
+package dockerless
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestImageLayers(t *testing.T) {
+	created := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	manifest := &v1.Manifest{}
+	for index := 0; index < 3; index++ {
+		manifest.Layers = append(manifest.Layers, v1.Descriptor{
+			MediaType: types.OCILayer,
+			Size:      int64(100 * (index + 1)),
+			Digest:    testHash(t, "a", index),
+		})
+	}
+
+	diffIDs := []v1.Hash{testHash(t, "d", 0), testHash(t, "d", 1), testHash(t, "d", 2)}
+
+	layer := func(index int, diffID bool, createdBy string) ImageLayer {
+		result := ImageLayer{
+			Digest:    manifest.Layers[index].Digest.String(),
+			MediaType: types.OCILayer,
+			Size:      manifest.Layers[index].Size,
+			CreatedBy: createdBy,
+		}
+
+		if diffID {
+			result.DiffID = diffIDs[index].String()
+		}
+
+		if createdBy != "" {
+			result.Created = created
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name    string
+		history []v1.History
+		diffIDs []v1.Hash
+		want    []ImageLayer
+	}{
+		{
+			name: "one history entry per layer",
+			history: []v1.History{
+				{Created: v1.Time{Time: created}, CreatedBy: "ADD rootfs.tar /"},
+				{Created: v1.Time{Time: created}, CreatedBy: "RUN apk add git"},
+				{Created: v1.Time{Time: created}, CreatedBy: "COPY . /app"},
+			},
+			diffIDs: diffIDs,
+			want:    []ImageLayer{layer(0, true, "ADD rootfs.tar /"), layer(1, true, "RUN apk add git"), layer(2, true, "COPY . /app")},
+		},
+		{
+			name: "empty layers are skipped",
+			history: []v1.History{
+				{Created: v1.Time{Time: created}, CreatedBy: "ADD rootfs.tar /"},
+				{Created: v1.Time{Time: created}, CreatedBy: "ENV PATH=/bin", EmptyLayer: true},
+				{Created: v1.Time{Time: created}, CreatedBy: "RUN apk add git"},
+				{Created: v1.Time{Time: created}, CreatedBy: "WORKDIR /app", EmptyLayer: true},
+				{Created: v1.Time{Time: created}, CreatedBy: "COPY . /app"},
+				{Created: v1.Time{Time: created}, CreatedBy: "CMD [\"sh\"]", EmptyLayer: true},
+			},
+			diffIDs: diffIDs,
+			want:    []ImageLayer{layer(0, true, "ADD rootfs.tar /"), layer(1, true, "RUN apk add git"), layer(2, true, "COPY . /app")},
+		},
+		{
+			name: "missing history entries",
+			history: []v1.History{
+				{Created: v1.Time{Time: created}, CreatedBy: "ADD rootfs.tar /"},
+			},
+			diffIDs: diffIDs,
+			want:    []ImageLayer{layer(0, true, "ADD rootfs.tar /"), layer(1, true, ""), layer(2, true, "")},
+		},
+		{
+			name:    "missing diff ids",
+			history: []v1.History{{Created: v1.Time{Time: created}, CreatedBy: "ADD rootfs.tar /"}},
+			diffIDs: diffIDs[:1],
+			want:    []ImageLayer{layer(0, true, "ADD rootfs.tar /"), layer(1, false, ""), layer(2, false, "")},
+		},
+		{
+			name: "no history nor diff ids",
+			want: []ImageLayer{layer(0, false, ""), layer(1, false, ""), layer(2, false, "")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &v1.ConfigFile{History: test.history, RootFS: v1.RootFS{Type: "layers", DiffIDs: test.diffIDs}}
+
+			got := imageLayers(manifest, config)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("imageLayers() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// testHash returns a fake sha256 hash made of input prefix and index.
+func testHash(t *testing.T, prefix string, index int) v1.Hash {
+	t.Helper()
+
+	hex := fmt.Sprintf("%s%063d", prefix, index)
+
+	hash, err := v1.NewHash("sha256:" + hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
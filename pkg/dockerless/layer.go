@@ -0,0 +1,415 @@
+package dockerless
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/loft-sh/log"
+	"golang.org/x/sys/unix"
+)
+
+// sparseBlockSize is the size of the chunks inspected for holes when
+// writing sparse files.
+const sparseBlockSize = 32 * 1024
+
+// UnpackLayers will apply input layers, in order, on top of target directory.
+// This is meant to be run inside the container's user namespace, see the
+// hidden "unpack" command, in order to preserve ownership of the files.
+func UnpackLayers(target string, layers []Layer, logger log.Logger) error {
+	err := os.MkdirAll(target, 0o755)
+	if err != nil {
+		return err
+	}
+
+	for index, layer := range layers {
+		logger.Debugf("unpacking layer %d of %d", index+1, len(layers))
+
+		err = unpackLayerFile(target, layer, logger)
+		if err != nil {
+			return fmt.Errorf("unpacking layer %s: %w", filepath.Base(layer.Path), err)
+		}
+	}
+
+	return nil
+}
+
+func unpackLayerFile(target string, layer Layer, logger log.Logger) error {
+	return readLayerFile(layer, func(reader io.Reader) error {
+		return ApplyLayer(target, reader, logger)
+	})
+}
+
+// readLayerFile will call apply with the uncompressed content of input layer.
+func readLayerFile(layer Layer, apply func(reader io.Reader) error) error {
+	file, err := os.Open(layer.Path)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	reader, err := decompressLayer(layer.MediaType, file)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = reader.Close() }()
+
+	return apply(reader)
+}
+
+// ApplyLayer will unpack the input uncompressed layer tarball on top of root.
+// Whiteouts and opaque directories are applied to the content of the lower layers
+// already present in root, following the OCI image-spec changeset rules.
+// Hardlinks, symlinks, xattrs (including security.capability), sparse files,
+// ownership and modification times are preserved.
+func ApplyLayer(root string, reader io.Reader, logger log.Logger) error {
+	return applyLayer(root, reader, false, logger)
+}
+
+// applyLayer will unpack the input uncompressed layer tarball in root. If overlay
+// is set, root is expected to be empty and whiteouts are converted to the overlayfs
+// format instead of being applied, see UnpackLayerSnapshots.
+func applyLayer(root string, reader io.Reader, overlay bool, logger log.Logger) error {
+	tarReader := tar.NewReader(reader)
+
+	// paths unpacked by this layer, they must survive opaque directories
+	unpacked := map[string]struct{}{}
+	// directories modification times are restored at the end, as
+	// unpacking their content changes them
+	dirs := map[string]*tar.Header{}
+
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name, err := cleanEntryName(header.Name)
+		if err != nil {
+			return err
+		}
+
+		// /dev is provided by the runtime, never by the image
+		if strings.HasPrefix(name, "/dev/") {
+			continue
+		}
+
+		// every write is confined to root, symlinks are resolved relative to it
+		path, err := resolveEntryPath(root, name)
+		if err != nil {
+			return err
+		}
+
+		dir, base := filepath.Split(path)
+
+		if base == whiteoutOpaqueDir {
+			if overlay {
+				err = makeParents(root, path, unpacked)
+				if err == nil {
+					err = convertOpaque(dir)
+				}
+			} else {
+				err = applyOpaque(dir, unpacked)
+			}
+
+			if err != nil {
+				return fmt.Errorf("%s: %w", header.Name, err)
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			// the hidden path is resolved like any other entry
+			hidden, err := resolveWhiteout(root, name)
+			if err != nil {
+				return err
+			}
+
+			if overlay {
+				err = makeParents(root, hidden, unpacked)
+				if err == nil {
+					err = convertWhiteout(hidden)
+				}
+			} else {
+				err = applyWhiteout(hidden)
+			}
+
+			if err != nil {
+				return fmt.Errorf("%s: %w", header.Name, err)
+			}
+
+			continue
+		}
+
+		err = makeParents(root, path, unpacked)
+		if err != nil {
+			return err
+		}
+
+		err = unpackEntry(root, path, header, tarReader, logger)
+		if err != nil {
+			return fmt.Errorf("%s: %w", header.Name, err)
+		}
+
+		unpacked[path] = struct{}{}
+
+		if header.Typeflag == tar.TypeDir {
+			dirs[path] = header
+		}
+	}
+
+	for path, header := range dirs {
+		err := setTimes(path, header)
+		if err != nil {
+			return fmt.Errorf("%s: %w", header.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// makeParents will ensure all the parent directories of path exist.
+func makeParents(root, path string, unpacked map[string]struct{}) error {
+	parent := filepath.Dir(path)
+
+	for dir := parent; dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		unpacked[dir] = struct{}{}
+	}
+
+	return os.MkdirAll(parent, 0o755)
+}
+
+func unpackEntry(root, path string, header *tar.Header, reader io.Reader, logger log.Logger) error {
+	info, err := os.Lstat(path)
+	if err == nil && path == root && header.Typeflag != tar.TypeDir {
+		// the root itself is never replaced, a "./" entry only sets its metadata
+		return nil
+	}
+
+	if err == nil && !(info.IsDir() && header.Typeflag == tar.TypeDir) {
+		// a previous layer (or entry) created something in the way, replace it
+		err = os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	mode := header.FileInfo().Mode()
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		err = os.Mkdir(path, 0o755)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+		err = writeFile(path, header, reader)
+		if err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		err = os.Symlink(header.Linkname, path)
+		if err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		linkName, err := cleanEntryName(header.Linkname)
+		if err != nil {
+			return err
+		}
+
+		linkTarget, err := resolveEntryPath(root, linkName)
+		if err != nil {
+			return err
+		}
+
+		err = os.Link(linkTarget, path)
+		if err != nil {
+			return err
+		}
+
+		// hardlinks share the inode, its metadata is already set
+		return nil
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		deviceMode := uint32(mode.Perm())
+
+		switch header.Typeflag {
+		case tar.TypeChar:
+			deviceMode |= unix.S_IFCHR
+		case tar.TypeBlock:
+			deviceMode |= unix.S_IFBLK
+		default:
+			deviceMode |= unix.S_IFIFO
+		}
+
+		err = unix.Mknod(path, deviceMode, int(unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))))
+		if err != nil {
+			// device nodes cannot be created inside a user namespace
+			logger.Debugf("skipping device %s: %v", header.Name, err)
+
+			return nil
+		}
+	case tar.TypeXGlobalHeader:
+		return nil
+	default:
+		logger.Debugf("skipping unsupported entry %s of type %c", header.Name, header.Typeflag)
+
+		return nil
+	}
+
+	err = os.Lchown(path, header.Uid, header.Gid)
+	if err != nil {
+		return err
+	}
+
+	// chown clears setuid/setgid bits, so chmod needs to happen after it
+	if header.Typeflag != tar.TypeSymlink {
+		err = os.Chmod(path, mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = setXattrs(path, header, logger)
+	if err != nil {
+		return err
+	}
+
+	if header.Typeflag == tar.TypeDir {
+		return nil
+	}
+
+	return setTimes(path, header)
+}
+
+// writeFile will write the content of a regular file entry to path.
+// Holes of sparse entries are recreated by seeking over zeroed blocks.
+func writeFile(path string, header *tar.Header, reader io.Reader) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	if !isSparse(header) {
+		_, err = io.Copy(file, reader)
+
+		return err
+	}
+
+	block := make([]byte, sparseBlockSize)
+	zero := make([]byte, sparseBlockSize)
+
+	for {
+		n, err := io.ReadFull(reader, block)
+		if n > 0 {
+			if bytes.Equal(block[:n], zero[:n]) {
+				_, err := file.Seek(int64(n), io.SeekCurrent)
+				if err != nil {
+					return err
+				}
+			} else {
+				_, err := file.Write(block[:n])
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// a trailing hole is only materialized by setting the size
+	return file.Truncate(header.Size)
+}
+
+func isSparse(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setXattrs will restore the extended attributes stored in the entry's PAX records.
+func setXattrs(path string, header *tar.Header, logger log.Logger) error {
+	for key, value := range header.PAXRecords {
+		if !strings.HasPrefix(key, "SCHILY.xattr.") {
+			continue
+		}
+
+		attr := strings.TrimPrefix(key, "SCHILY.xattr.")
+
+		// images cannot drive overlayfs, whiteouts are converted from the tarball's
+		if strings.HasPrefix(attr, "trusted.overlay.") || strings.HasPrefix(attr, overlayXattrPrefix) {
+			logger.Debugf("skipping xattr %s on %s", attr, header.Name)
+
+			continue
+		}
+
+		err := unix.Lsetxattr(path, attr, []byte(value), 0)
+		if err != nil {
+			// namespaces like trusted.* are not available to unprivileged users
+			if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP) {
+				logger.Debugf("skipping xattr %s on %s: %v", attr, header.Name, err)
+
+				continue
+			}
+
+			return fmt.Errorf("setting xattr %s: %w", attr, err)
+		}
+	}
+
+	return nil
+}
+
+func setTimes(path string, header *tar.Header) error {
+	accessTime := header.AccessTime
+	if accessTime.IsZero() {
+		accessTime = header.ModTime
+	}
+
+	times := []unix.Timespec{
+		unix.NsecToTimespec(accessTime.UnixNano()),
+		unix.NsecToTimespec(header.ModTime.UnixNano()),
+	}
+
+	if header.ModTime.IsZero() {
+		now := unix.NsecToTimespec(time.Now().UnixNano())
+		times = []unix.Timespec{now, now}
+	}
+
+	err := unix.UtimesNanoAt(unix.AT_FDCWD, path, times, unix.AT_SYMLINK_NOFOLLOW)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil
+	}
+
+	return err
+}
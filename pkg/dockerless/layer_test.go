@@ -0,0 +1,257 @@
+package dockerless
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/log"
+	"golang.org/x/sys/unix"
+)
+
+func TestApplyLayerHardlinks(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+
+	layer := testTarball(t, []testEntry{
+		{header: tar.Header{Name: "real/", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "real/file", Typeflag: tar.TypeReg, Mode: 0o644}, content: "content"},
+		{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "real"}},
+		{header: tar.Header{Name: "absolute", Typeflag: tar.TypeSymlink, Linkname: "/real"}},
+		{header: tar.Header{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "real/file"}},
+		// the links are resolved inside root, whatever the symlinks on the way
+		{header: tar.Header{Name: "behind-link", Typeflag: tar.TypeLink, Linkname: "link/file"}},
+		{header: tar.Header{Name: "behind-absolute", Typeflag: tar.TypeLink, Linkname: "absolute/file"}},
+	})
+
+	err := ApplyLayer(root, layer, log.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.Stat(filepath.Join(root, "real", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"hardlink", "behind-link", "behind-absolute"} {
+		info, err := os.Lstat(filepath.Join(root, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+
+			continue
+		}
+
+		if !os.SameFile(info, target) {
+			t.Errorf("%s is not a hardlink of real/file", name)
+		}
+	}
+
+	if nlink := target.Sys().(*syscall.Stat_t).Nlink; nlink != 4 {
+		t.Errorf("real/file has %d links, want 4", nlink)
+	}
+
+	// a link outside of root is rejected
+	err = ApplyLayer(root, testTarball(t, []testEntry{
+		{header: tar.Header{Name: "escape", Typeflag: tar.TypeLink, Linkname: "../outside"}},
+	}), log.Discard)
+	if err == nil {
+		t.Errorf("ApplyLayer() of a hardlink outside of root succeeded")
+	}
+}
+
+func TestApplyLayerMetadata(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = 1000, 2000
+	}
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	root := filepath.Join(t.TempDir(), "root")
+
+	// as with UnpackLayers, the root already exists
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := testTarball(t, []testEntry{
+		{header: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o750, Uid: uid, Gid: gid, ModTime: modTime}},
+		{header: tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o1777, Uid: uid, Gid: gid, ModTime: modTime}},
+		{header: tar.Header{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0o4755, Uid: uid, Gid: gid, ModTime: modTime}, content: "content"},
+		{header: tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file", Uid: uid, Gid: gid, ModTime: modTime}},
+	})
+
+	err = ApplyLayer(root, layer, log.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		mode os.FileMode
+	}{
+		// the root gets the metadata of the "./" entry as well
+		{path: "", mode: os.ModeDir | 0o750},
+		{path: "dir", mode: os.ModeDir | os.ModeSticky | 0o777},
+		{path: "dir/file", mode: os.ModeSetuid | 0o755},
+		{path: "dir/link", mode: os.ModeSymlink | 0o777},
+	}
+
+	for _, test := range tests {
+		info, err := os.Lstat(filepath.Join(root, test.path))
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+
+			continue
+		}
+
+		if info.Mode() != test.mode {
+			t.Errorf("%s has mode %s, want %s", test.path, info.Mode(), test.mode)
+		}
+
+		stat := info.Sys().(*syscall.Stat_t)
+		if int(stat.Uid) != uid || int(stat.Gid) != gid {
+			t.Errorf("%s is owned by %d:%d, want %d:%d", test.path, stat.Uid, stat.Gid, uid, gid)
+		}
+
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("%s was modified at %s, want %s", test.path, info.ModTime(), modTime)
+		}
+	}
+}
+
+func TestApplyLayerXattrs(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unix.Lsetxattr(root, "user.probe", []byte("1"), 0)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+		t.Skipf("user xattrs are not supported: %v", err)
+	}
+
+	layer := testTarball(t, []testEntry{
+		{
+			header: tar.Header{
+				Name:     "file",
+				Typeflag: tar.TypeReg,
+				Mode:     0o644,
+				PAXRecords: map[string]string{
+					"SCHILY.xattr.user.comment":                     "value",
+					"SCHILY.xattr." + overlayXattrPrefix + "opaque": "y",
+				},
+			},
+		},
+	})
+
+	err = ApplyLayer(root, layer, log.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(root, "file")
+	value := make([]byte, 64)
+
+	size, err := unix.Lgetxattr(path, "user.comment", value)
+	if err != nil || string(value[:size]) != "value" {
+		t.Errorf("xattr user.comment = %q, %v, want value", value[:max(size, 0)], err)
+	}
+
+	// images cannot drive overlayfs
+	_, err = unix.Lgetxattr(path, overlayXattrPrefix+"opaque", value)
+	if !errors.Is(err, unix.ENODATA) {
+		t.Errorf("xattr %sopaque was set: %v", overlayXattrPrefix, err)
+	}
+}
+
+func TestWriteFileSparse(t *testing.T) {
+	content := append(bytes.Repeat([]byte{0}, 4*sparseBlockSize), []byte("data")...)
+	content = append(content, bytes.Repeat([]byte{0}, 4*sparseBlockSize)...)
+
+	header := &tar.Header{
+		Name:       "sparse",
+		Typeflag:   tar.TypeReg,
+		Size:       int64(len(content)),
+		PAXRecords: map[string]string{"GNU.sparse.major": "1", "GNU.sparse.minor": "0"},
+	}
+
+	path := filepath.Join(t.TempDir(), "sparse")
+
+	err := writeFile(path, header, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Fatalf("sparse file content differs, %d bytes written of %d", len(got), len(content))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// holes take no blocks, unless the filesystem does not support them
+	allocated := info.Sys().(*syscall.Stat_t).Blocks * 512
+	if allocated >= int64(len(content)) {
+		t.Errorf("sparse file allocates %d bytes for %d bytes of content", allocated, len(content))
+	}
+}
+
+// testEntry is an entry of a tarball built by testTarball.
+type testEntry struct {
+	header  tar.Header
+	content string
+}
+
+// testTarball returns an uncompressed layer made of input entries.
+func testTarball(t *testing.T, entries []testEntry) io.Reader {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(buffer)
+
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.content))
+
+		if strings.HasSuffix(header.Name, "/") || header.Typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+
+		if len(header.PAXRecords) > 0 {
+			header.Format = tar.FormatPAX
+		}
+
+		err := tarWriter.WriteHeader(&header)
+		if err == nil {
+			_, err = tarWriter.Write([]byte(entry.content))
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := tarWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer
+}
@@ -0,0 +1,98 @@
+package dockerless
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Layer is a layer blob to unpack, together with its media type.
+type Layer struct {
+	Path      string
+	MediaType types.MediaType
+}
+
+// String returns the layer in the MEDIATYPE=PATH form used by the unpack command.
+func (l Layer) String() string {
+	return string(l.MediaType) + "=" + l.Path
+}
+
+// ParseLayer parses a layer in the MEDIATYPE=PATH form used by the unpack command.
+// A bare PATH is accepted too, its compression will be detected from its content.
+func ParseLayer(arg string) Layer {
+	mediaType, path, ok := strings.Cut(arg, "=")
+	if !ok {
+		return Layer{Path: arg}
+	}
+
+	return Layer{Path: path, MediaType: types.MediaType(mediaType)}
+}
+
+// CheckLayerMediaType returns an error if layers with input media type cannot be unpacked.
+func CheckLayerMediaType(mediaType types.MediaType) error {
+	switch mediaType {
+	case types.OCILayer, types.DockerLayer,
+		types.OCILayerZStd,
+		types.OCIUncompressedLayer, types.DockerUncompressedLayer:
+		return nil
+	case types.DockerForeignLayer, types.OCIRestrictedLayer, types.OCIUncompressedRestrictedLayer:
+		return fmt.Errorf("non-distributable layer media type %s is not supported", mediaType)
+	default:
+		return fmt.Errorf("unknown layer media type %s", mediaType)
+	}
+}
+
+// decompressLayer returns a reader of the uncompressed tarball of a layer with
+// input media type. An empty media type detects the compression from the content.
+func decompressLayer(mediaType types.MediaType, reader io.Reader) (io.ReadCloser, error) {
+	switch mediaType {
+	case types.OCILayer, types.DockerLayer:
+		return gzip.NewReader(reader)
+	case types.OCILayerZStd:
+		return newZstdReader(reader)
+	case types.OCIUncompressedLayer, types.DockerUncompressedLayer:
+		return io.NopCloser(reader), nil
+	case "":
+		return detectCompression(reader)
+	}
+
+	return nil, CheckLayerMediaType(mediaType)
+}
+
+func detectCompression(reader io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(reader)
+
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return newZstdReader(buffered)
+	default:
+		return io.NopCloser(buffered), nil
+	}
+}
+
+func newZstdReader(reader io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoder.IOReadCloser(), nil
+}
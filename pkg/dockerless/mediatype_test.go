@@ -0,0 +1,100 @@
+package dockerless
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDecompressLayer(t *testing.T) {
+	content := testLayer(t, []string{"dir/", "dir/file"}).Bytes()
+
+	gzipped := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(gzipped)
+
+	_, err := gzipWriter.Write(content)
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zstdWriter, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zstded := zstdWriter.EncodeAll(content, nil)
+
+	tests := []struct {
+		mediaType types.MediaType
+		blob      []byte
+	}{
+		{mediaType: types.OCILayer, blob: gzipped.Bytes()},
+		{mediaType: types.DockerLayer, blob: gzipped.Bytes()},
+		{mediaType: types.OCILayerZStd, blob: zstded},
+		{mediaType: types.OCIUncompressedLayer, blob: content},
+		{mediaType: types.DockerUncompressedLayer, blob: content},
+		// without a media type, the compression is detected
+		{blob: gzipped.Bytes()},
+		{blob: zstded},
+		{blob: content},
+	}
+
+	for _, test := range tests {
+		reader, err := decompressLayer(test.mediaType, bytes.NewReader(test.blob))
+		if err != nil {
+			t.Errorf("decompressLayer(%q) error = %v", test.mediaType, err)
+
+			continue
+		}
+
+		got, err := io.ReadAll(reader)
+		_ = reader.Close()
+
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("decompressLayer(%q) read %d bytes, %v, want the %d bytes of the tarball", test.mediaType, len(got), err, len(content))
+		}
+	}
+
+	// a blob not matching its media type is not unpacked
+	reader, err := decompressLayer(types.OCILayerZStd, bytes.NewReader(gzipped.Bytes()))
+	if err == nil {
+		_, err = io.ReadAll(reader)
+	}
+
+	if err == nil {
+		t.Errorf("decompressLayer(%q) of a gzip blob succeeded", types.OCILayerZStd)
+	}
+}
+
+func TestDecompressLayerUnsupported(t *testing.T) {
+	tests := []struct {
+		mediaType types.MediaType
+		wantErr   string
+	}{
+		{mediaType: types.DockerForeignLayer, wantErr: "non-distributable"},
+		{mediaType: types.OCIRestrictedLayer, wantErr: "non-distributable"},
+		{mediaType: types.OCIUncompressedRestrictedLayer, wantErr: "non-distributable"},
+		{mediaType: "application/vnd.oci.image.layer.v1.tar+bzip2", wantErr: "unknown layer media type"},
+		{mediaType: types.OCIConfigJSON, wantErr: "unknown layer media type"},
+	}
+
+	for _, test := range tests {
+		reader, err := decompressLayer(test.mediaType, strings.NewReader("content"))
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("decompressLayer(%q) = %v, %v, want %s", test.mediaType, reader, err, test.wantErr)
+		}
+
+		if CheckLayerMediaType(test.mediaType) == nil {
+			t.Errorf("CheckLayerMediaType(%q) accepted the media type", test.mediaType)
+		}
+	}
+}
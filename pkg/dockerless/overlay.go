@@ -0,0 +1,374 @@
+package dockerless
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/loft-sh/log"
+	"golang.org/x/sys/unix"
+)
+
+// maxOverlayOptions is the maximum length of the overlayfs mount options, a page.
+const maxOverlayOptions = 4096
+
+// LayersDir returns the directory holding the layers extracted once, shared by
+// the overlayfs workspaces.
+func (p *DockerlessProvider) LayersDir() string {
+	return filepath.Join(p.Config.TargetDir, "layers")
+}
+
+// layerDir returns the directory holding the layer with input digest, extracted.
+func (p *DockerlessProvider) layerDir(digest v1.Hash) string {
+	return filepath.Join(p.LayersDir(), digest.Algorithm, digest.Hex)
+}
+
+// OverlayDir returns the directory holding the upper and work directories of
+// the overlayfs of the workspace with input id.
+func (p *DockerlessProvider) OverlayDir(workspaceId string) string {
+	return filepath.Join(p.Config.TargetDir, "overlay", workspaceId)
+}
+
+// workspaceLayers returns the digests of the layers the overlayfs of the workspace
+// with input id is made of, from the lowest. Returns false for workspaces using
+// a fully extracted rootfs.
+func (p *DockerlessProvider) workspaceLayers(workspaceId string) ([]v1.Hash, bool) {
+	return readLayersFile(filepath.Join(p.Config.TargetDir, "status", workspaceId, "layers"))
+}
+
+// readLayersFile returns the layer digests recorded in the file at path, false if missing.
+func readLayersFile(path string) ([]v1.Hash, bool) {
+	layersBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	layers := []v1.Hash{}
+
+	err = json.Unmarshal(layersBytes, &layers)
+	if err != nil {
+		return nil, false
+	}
+
+	return layers, true
+}
+
+// saveWorkspaceLayers will record the layers the overlayfs of the workspace with input id is made of.
+func (p *DockerlessProvider) saveWorkspaceLayers(workspaceId string, layers []v1.Hash) error {
+	layersBytes, err := json.Marshal(layers)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(p.Config.TargetDir, "status", workspaceId, "layers"), layersBytes, 0o644)
+}
+
+// overlaySupported returns whether the workspace with input id can use an overlayfs rootfs
+// made of the layers of input manifest. The overlayfs is mounted inside the user namespace,
+// which needs linux 5.11 or later, and its lower directories must fit in the mount options.
+func (p *DockerlessProvider) overlaySupported(workspaceId string, manifest *v1.Manifest) bool {
+	if len(manifest.Layers) == 0 {
+		return false
+	}
+
+	options := len("lowerdir=,upperdir=,workdir=,userxattr") + 2*len(p.OverlayDir(workspaceId)) + len("/upper/work")
+	for _, layer := range manifest.Layers {
+		options += len(p.overlayLowerDir(layer.Digest)) + 1
+	}
+
+	if options > maxOverlayOptions {
+		p.Log.Debugf("too many layers for overlayfs, extracting the full rootfs")
+
+		return false
+	}
+
+	err := os.MkdirAll(p.LayersDir(), os.ModePerm)
+	if err != nil {
+		return false
+	}
+
+	cmd := NamespacedCommand(workspaceId, os.Args[0], "check-overlay", p.LayersDir())
+	cmd.Env = os.Environ()
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		p.Log.Debugf("overlayfs not supported, extracting the full rootfs: %v %s", err, strings.TrimSpace(string(output)))
+
+		return false
+	}
+
+	return true
+}
+
+// prepareOverlay will extract the layers of the workspace with input id that are not
+// already, and record them as the lower directories of the workspace's overlayfs.
+func (p *DockerlessProvider) prepareOverlay(workspaceId string, manifest *v1.Manifest) error {
+	err := p.extractLayers(workspaceId, manifest)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{"upper", "work"} {
+		err = os.MkdirAll(filepath.Join(p.OverlayDir(workspaceId), dir), 0o755)
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.saveWorkspaceLayers(workspaceId, manifestDigests(manifest))
+}
+
+// extractLayers will extract the layers of input manifest that are not already,
+// each in its own directory, in the user namespace of the workspace with input id.
+func (p *DockerlessProvider) extractLayers(workspaceId string, manifest *v1.Manifest) error {
+	missing := []Layer{}
+
+	for _, layer := range manifest.Layers {
+		if !Exist(p.layerDir(layer.Digest)) {
+			missing = append(missing, Layer{
+				Path:      p.BlobPath(layer.Digest),
+				MediaType: layer.MediaType,
+			})
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	p.Log.Debugf("extracting %d layers", len(missing))
+
+	args := []string{os.Args[0], "unpack", "--overlay", filepath.Join(p.LayersDir(), manifest.Layers[0].Digest.Algorithm)}
+	for _, layer := range missing {
+		args = append(args, layer.String())
+	}
+
+	cmd := NamespacedCommand(workspaceId, args...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("extracting layers: %w", err)
+	}
+
+	return nil
+}
+
+// layerDirs returns the extracted layers with input digests, the topmost first,
+// as overlayfs lists its lower directories.
+func (p *DockerlessProvider) layerDirs(digests []v1.Hash) []string {
+	dirs := []string{}
+	for index := len(digests) - 1; index >= 0; index-- {
+		dirs = append(dirs, p.layerDir(digests[index]))
+	}
+
+	return dirs
+}
+
+// unusedLayerDirs returns the extracted layers no workspace nor snapshot uses anymore.
+func (p *DockerlessProvider) unusedLayerDirs() ([]string, error) {
+	used := map[string]bool{}
+
+	workspaces, err := os.ReadDir(filepath.Join(p.Config.TargetDir, "status"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, workspace := range workspaces {
+		layers, _ := p.workspaceLayers(workspace.Name())
+		for _, layer := range layers {
+			used[p.layerDir(layer)] = true
+		}
+	}
+
+	snapshots, err := p.ListSnapshots("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range snapshots {
+		layers, _ := readLayersFile(filepath.Join(p.SnapshotsDir(snapshot.Workspace), snapshot.Name, "status", "layers"))
+		for _, layer := range layers {
+			used[p.layerDir(layer)] = true
+		}
+	}
+
+	algorithms, err := os.ReadDir(p.LayersDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	unused := []string{}
+
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue
+		}
+
+		layers, err := os.ReadDir(filepath.Join(p.LayersDir(), algorithm.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, layer := range layers {
+			dir := filepath.Join(p.LayersDir(), algorithm.Name(), layer.Name())
+
+			// temporary directories may belong to a running extraction
+			if !strings.HasPrefix(layer.Name(), ".") && !used[dir] {
+				unused = append(unused, dir)
+			}
+		}
+	}
+
+	return unused, nil
+}
+
+// overlayLowerDir returns the lower directory of the layer with input digest, relative
+// to LayersDir in order to fit more layers in the mount options.
+func (p *DockerlessProvider) overlayLowerDir(digest v1.Hash) string {
+	return filepath.Join(digest.Algorithm, digest.Hex)
+}
+
+// mountOverlay will mount the overlayfs rootfs of the workspace with input id
+// on rootfs, made of input layers and of the workspace's upper directory.
+// This is meant to be run inside the container's mount namespace.
+func (p *DockerlessProvider) mountOverlay(workspaceId, rootfs string, layers []v1.Hash) error {
+	// the topmost layer comes first
+	lowerDirs := []string{}
+	for index := len(layers) - 1; index >= 0; index-- {
+		lowerDirs = append(lowerDirs, p.overlayLowerDir(layers[index]))
+	}
+
+	options := fmt.Sprintf(
+		"lowerdir=%s,upperdir=%s,workdir=%s,userxattr",
+		strings.Join(lowerDirs, ":"),
+		filepath.Join(p.OverlayDir(workspaceId), "upper"),
+		filepath.Join(p.OverlayDir(workspaceId), "work"),
+	)
+
+	err := os.MkdirAll(rootfs, 0o755)
+	if err != nil {
+		return err
+	}
+
+	// lower directories are relative to the layers directory
+	err = os.Chdir(p.LayersDir())
+	if err != nil {
+		return err
+	}
+
+	err = unix.Mount("overlay", rootfs, "overlay", 0, options)
+	if err != nil {
+		return fmt.Errorf("mounting overlayfs rootfs: %w", err)
+	}
+
+	return nil
+}
+
+// CheckOverlay returns an error if an overlayfs with converted whiteouts cannot be
+// mounted, using a temporary directory inside dir.
+// This is meant to be run inside the container's user namespace, see the hidden
+// "check-overlay" command.
+func CheckOverlay(dir string) error {
+	tempDir, err := os.MkdirTemp(dir, ".check-")
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	lower := filepath.Join(tempDir, "lower")
+	merged := filepath.Join(tempDir, "merged")
+
+	for _, path := range []string{filepath.Join(lower, "opaque"), filepath.Join(tempDir, "upper"), filepath.Join(tempDir, "work"), merged} {
+		err = os.MkdirAll(path, 0o755)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = convertWhiteout(filepath.Join(lower, "deleted"))
+	if err != nil {
+		return fmt.Errorf("creating whiteout: %w", err)
+	}
+
+	err = convertOpaque(filepath.Join(lower, "opaque"))
+	if err != nil {
+		return fmt.Errorf("creating opaque directory: %w", err)
+	}
+
+	options := fmt.Sprintf(
+		"lowerdir=%s,upperdir=%s,workdir=%s,userxattr",
+		lower,
+		filepath.Join(tempDir, "upper"),
+		filepath.Join(tempDir, "work"),
+	)
+
+	err = unix.Mount("overlay", merged, "overlay", 0, options)
+	if err != nil {
+		return fmt.Errorf("mounting overlayfs: %w", err)
+	}
+
+	return unix.Unmount(merged, unix.MNT_DETACH)
+}
+
+// UnpackLayerSnapshots will extract each of input layers in its own directory inside
+// dir, named after its blob, skipping the ones already there. Whiteouts are converted
+// to the overlayfs format, as layers are used as overlayfs lower directories.
+// This is meant to be run inside the container's user namespace, see the hidden
+// "unpack" command, in order to preserve ownership of the files.
+func UnpackLayerSnapshots(dir string, layers []Layer, logger log.Logger) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	for index, layer := range layers {
+		target := filepath.Join(dir, filepath.Base(layer.Path))
+		if Exist(target) {
+			continue
+		}
+
+		logger.Debugf("extracting layer %d of %d", index+1, len(layers))
+
+		// extracted aside then renamed, so that partial layers are never used
+		tempDir, err := os.MkdirTemp(dir, ".extract-")
+		if err != nil {
+			return err
+		}
+
+		err = os.Chmod(tempDir, 0o755)
+		if err != nil {
+			return err
+		}
+
+		err = readLayerFile(layer, func(reader io.Reader) error {
+			return applyLayer(tempDir, reader, true, logger)
+		})
+		if err != nil {
+			_ = os.RemoveAll(tempDir)
+
+			return fmt.Errorf("extracting layer %s: %w", filepath.Base(layer.Path), err)
+		}
+
+		err = os.Rename(tempDir, target)
+		if err != nil {
+			_ = os.RemoveAll(tempDir)
+
+			// extracted concurrently by another workspace
+			if Exist(target) {
+				continue
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package dockerless
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/loft-sh/devpod/pkg/driver"
+)
+
+// Platform returns the platform images are pulled for.
+// This is the PLATFORM option if set, else the host's one.
+func (p *DockerlessProvider) Platform() (*v1.Platform, error) {
+	if p.Config.Platform == "" {
+		return &v1.Platform{
+			OS:           "linux",
+			Architecture: runtime.GOARCH,
+		}, nil
+	}
+
+	platform, err := v1.ParsePlatform(p.Config.Platform)
+	if err != nil {
+		return nil, fmt.Errorf("invalid platform %s: %w", p.Config.Platform, err)
+	}
+
+	return platform, nil
+}
+
+// TargetArchitecture returns the architecture of the workspace.
+// If the workspace was already created, this is the architecture of its stored image,
+// else the architecture of the configured platform.
+func (p *DockerlessProvider) TargetArchitecture(ctx context.Context, workspaceId string) (string, error) {
+	statusDIR := filepath.Join(p.Config.TargetDir, "status", workspaceId)
+
+	runOptionsBytes, err := os.ReadFile(filepath.Join(statusDIR, "runOptions"))
+	if err == nil {
+		runOptions := driver.RunOptions{}
+
+		err = json.Unmarshal(runOptionsBytes, &runOptions)
+		if err != nil {
+			return "", err
+		}
+
+		imageConfig, err := readImageConfig(p.ImageDir(runOptions.Image))
+		if err == nil && imageConfig.Architecture != "" {
+			return imageConfig.Architecture, nil
+		}
+	}
+
+	platform, err := p.Platform()
+	if err != nil {
+		return "", err
+	}
+
+	return platform.Architecture, nil
+}
+
+// checkPlatform will ensure that, if input descriptor is a manifest list,
+// it has an entry for input platform. The returned error lists the available ones.
+func checkPlatform(ref name.Reference, desc *remote.Descriptor, platform *v1.Platform) error {
+	if !desc.MediaType.IsIndex() {
+		return nil
+	}
+
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return err
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	available := []string{}
+
+	for _, manifest := range indexManifest.Manifests {
+		if manifest.Platform == nil {
+			continue
+		}
+
+		if manifest.Platform.Satisfies(*platform) {
+			return nil
+		}
+
+		available = append(available, manifest.Platform.String())
+	}
+
+	return fmt.Errorf(
+		"image %s has no match for platform %s, available platforms: %s",
+		ref.Name(),
+		platform.String(),
+		strings.Join(available, ", "),
+	)
+}
+
+// readImageConfig will read the config.json of an image stored in imageDir.
+func readImageConfig(imageDir string) (*v1.ConfigFile, error) {
+	file, err := os.Open(filepath.Join(imageDir, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	return v1.ParseConfigFile(file)
+}
@@ -0,0 +1,119 @@
+package dockerless
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+)
+
+func TestPlatform(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     string
+		wantErr  bool
+	}{
+		{want: "linux/" + runtime.GOARCH},
+		{platform: "linux/arm64", want: "linux/arm64"},
+		{platform: "linux/arm/v7", want: "linux/arm/v7"},
+		{platform: "linux/arm64/v8", want: "linux/arm64/v8"},
+		{platform: "linux/amd64/v2/extra", wantErr: true},
+	}
+
+	for _, test := range tests {
+		provider := &DockerlessProvider{
+			Config: &options.Options{TargetDir: t.TempDir(), Platform: test.platform},
+			Log:    log.Discard,
+		}
+
+		platform, err := provider.Platform()
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Platform() with PLATFORM %q = %s, want an error", test.platform, platform)
+			}
+
+			continue
+		}
+
+		if err != nil || platform.String() != test.want {
+			t.Errorf("Platform() with PLATFORM %q = %v, %v, want %s", test.platform, platform, err, test.want)
+		}
+	}
+}
+
+func TestCheckPlatform(t *testing.T) {
+	ref, err := name.ParseReference("registry.example.com/app:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := &v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+		Manifests: []v1.Descriptor{
+			{MediaType: types.OCIManifestSchema1, Digest: testHash(t, "a", 0), Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+			{MediaType: types.OCIManifestSchema1, Digest: testHash(t, "a", 1), Platform: &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+			{MediaType: types.OCIManifestSchema1, Digest: testHash(t, "a", 2), Platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+			// attestations have no platform
+			{MediaType: types.OCIManifestSchema1, Digest: testHash(t, "a", 3)},
+		},
+	}
+
+	rawIndex, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := &remote.Descriptor{Descriptor: v1.Descriptor{MediaType: types.OCIImageIndex}, Manifest: rawIndex}
+
+	tests := []struct {
+		platform string
+		wantErr  bool
+	}{
+		{platform: "linux/amd64"},
+		{platform: "linux/arm/v7"},
+		// without a variant any variant matches
+		{platform: "linux/arm"},
+		{platform: "linux/arm64"},
+		{platform: "linux/arm64/v8"},
+		{platform: "linux/arm/v6", wantErr: true},
+		{platform: "linux/s390x", wantErr: true},
+		{platform: "windows/amd64", wantErr: true},
+	}
+
+	for _, test := range tests {
+		platform, err := v1.ParsePlatform(test.platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = checkPlatform(ref, desc, platform)
+		if test.wantErr {
+			want := "image registry.example.com/app:latest has no match for platform " + test.platform +
+				", available platforms: linux/amd64, linux/arm/v7, linux/arm64/v8"
+			if err == nil || err.Error() != want {
+				t.Errorf("checkPlatform(%s) error = %v, want %s", test.platform, err, want)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("checkPlatform(%s) error = %v", test.platform, err)
+		}
+	}
+
+	// a single image has no platforms to choose from
+	single := &remote.Descriptor{Descriptor: v1.Descriptor{MediaType: types.OCIManifestSchema1}}
+
+	err = checkPlatform(ref, single, &v1.Platform{OS: "linux", Architecture: "s390x"})
+	if err != nil {
+		t.Errorf("checkPlatform() of a single image error = %v", err)
+	}
+}
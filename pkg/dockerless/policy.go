@@ -0,0 +1,219 @@
+package dockerless
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+const (
+	// PolicyAccept accepts any image.
+	PolicyAccept = "insecureAcceptAnything"
+	// PolicyReject rejects any image.
+	PolicyReject = "reject"
+	// PolicyDigestPinned only accepts images referenced by digest.
+	// This is specific to this provider, not part of containers' policy.json.
+	PolicyDigestPinned = "dockerlessDigestPinned"
+)
+
+// Policy is the subset of containers' policy.json in use, read from TARGET_DIR only
+// so that the host's own policy for other tools does not apply.
+// See https://github.com/containers/image/blob/main/docs/containers-policy.json.5.md
+type Policy struct {
+	Default    []PolicyRequirement                       `json:"default"`
+	Transports map[string]map[string][]PolicyRequirement `json:"transports"`
+}
+
+// PolicyRequirement is a requirement an image must satisfy to be used.
+type PolicyRequirement struct {
+	Type string `json:"type"`
+}
+
+// PolicyFile returns the path of the policy.json in use, TARGET_DIR/policy.json,
+// empty if it does not exist.
+func (p *DockerlessProvider) PolicyFile() string {
+	path := filepath.Join(p.Config.TargetDir, "policy.json")
+	if !Exist(path) {
+		return ""
+	}
+
+	return path
+}
+
+// Policy returns the parsed policy.json, nil if none exists.
+func (p *DockerlessProvider) Policy() (*Policy, error) {
+	path := p.PolicyFile()
+	if path == "" {
+		return nil, nil
+	}
+
+	policyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{}
+
+	err = json.Unmarshal(policyBytes, policy)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+
+	err = policy.validate()
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+
+	return policy, nil
+}
+
+// validate returns an error if the policy has no default or uses requirement
+// types that are not supported.
+func (policy *Policy) validate() error {
+	if len(policy.Default) == 0 {
+		return fmt.Errorf("default policy is empty")
+	}
+
+	all := [][]PolicyRequirement{policy.Default}
+	for _, scopes := range policy.Transports {
+		for _, requirements := range scopes {
+			all = append(all, requirements)
+		}
+	}
+
+	for _, requirements := range all {
+		for _, requirement := range requirements {
+			switch requirement.Type {
+			case PolicyAccept, PolicyReject, PolicyDigestPinned:
+			case "signedBy", "sigstoreSigned":
+				return fmt.Errorf("requirement type %q is not supported, use SIGNATURE_PUBLIC_KEYS to require signatures", requirement.Type)
+			default:
+				return fmt.Errorf("unsupported requirement type %q, expected one of %s, %s, %s", requirement.Type, PolicyAccept, PolicyReject, PolicyDigestPinned)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckPolicy returns an error if input image is not allowed by the policy.json in use.
+// Without a policy.json every image is allowed.
+func (p *DockerlessProvider) CheckPolicy(ref name.Reference) error {
+	_, byDigest := ref.(name.Digest)
+
+	return p.checkPolicy("docker", dockerScopes(ref), ref.Name(), byDigest)
+}
+
+// checkImagePolicy returns an error if input image, either a registry reference or
+// one imported with a transport prefix, is not allowed by the policy.json in use.
+func (p *DockerlessProvider) checkImagePolicy(image string) error {
+	imported := parseImportReference(image)
+	if imported != nil {
+		return p.checkImportPolicy(imported)
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return err
+	}
+
+	return p.CheckPolicy(ref)
+}
+
+// checkPolicy returns an error if input image is not allowed by the policy.json in use,
+// scopes being the ones of the transport matching the image, from the most specific.
+func (p *DockerlessProvider) checkPolicy(transport string, scopes []string, image string, byDigest bool) error {
+	policy, err := p.Policy()
+	if err != nil {
+		return err
+	}
+
+	if policy == nil {
+		return nil
+	}
+
+	requirements, scope := policy.requirements(transport, scopes)
+
+	for _, requirement := range requirements {
+		err = requirement.check(byDigest)
+		if err != nil {
+			return fmt.Errorf("image %s rejected by policy %s for %s: %w", image, p.PolicyFile(), scope, err)
+		}
+	}
+
+	return nil
+}
+
+// requirements returns the requirements of the first of input scopes of the transport
+// found in the policy, then of the transport's default and finally the global default.
+// It also returns the scope in use.
+func (policy *Policy) requirements(transport string, scopes []string) ([]PolicyRequirement, string) {
+	transportScopes := policy.Transports[transport]
+
+	for _, scope := range scopes {
+		requirements, ok := transportScopes[scope]
+		if ok {
+			return requirements, scope
+		}
+	}
+
+	requirements, ok := transportScopes[""]
+	if ok {
+		return requirements, fmt.Sprintf("the %s transport default", transport)
+	}
+
+	return policy.Default, "the default"
+}
+
+// dockerScopes returns the scopes of the docker transport matching input reference.
+// As in containers, scopes are in order: the image, its repository, its parent
+// namespaces, its registry, then the wildcards matching its registry.
+func dockerScopes(ref name.Reference) []string {
+	repository := referenceKey(ref)
+	separator := ":"
+	if _, ok := ref.(name.Digest); ok {
+		separator = "@"
+	}
+
+	scopes := []string{repository + separator + ref.Identifier()}
+	for scope := repository; scope != ""; {
+		scopes = append(scopes, scope)
+
+		index := strings.LastIndex(scope, "/")
+		if index < 0 {
+			break
+		}
+
+		scope = scope[:index]
+	}
+
+	host := normalizeRegistry(ref.Context().RegistryStr())
+	for index := strings.Index(host, "."); index >= 0; index = strings.Index(host, ".") {
+		host = host[index+1:]
+		scopes = append(scopes, "*."+host)
+	}
+
+	return scopes
+}
+
+// check returns an error if input image does not satisfy the requirement.
+func (requirement PolicyRequirement) check(byDigest bool) error {
+	switch requirement.Type {
+	case PolicyAccept:
+		return nil
+	case PolicyReject:
+		return fmt.Errorf("images are rejected")
+	case PolicyDigestPinned:
+		if !byDigest {
+			return fmt.Errorf("images must be referenced by digest")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported requirement type %q", requirement.Type)
+	}
+}
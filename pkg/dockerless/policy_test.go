@@ -0,0 +1,198 @@
+package dockerless
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+)
+
+func TestPolicyRequirementCheck(t *testing.T) {
+	tests := []struct {
+		requirement string
+		byDigest    bool
+		wantErr     bool
+	}{
+		{requirement: PolicyAccept},
+		{requirement: PolicyAccept, byDigest: true},
+		{requirement: PolicyReject, wantErr: true},
+		{requirement: PolicyReject, byDigest: true, wantErr: true},
+		{requirement: PolicyDigestPinned, wantErr: true},
+		{requirement: PolicyDigestPinned, byDigest: true},
+		{requirement: "digestPinned", byDigest: true, wantErr: true},
+		{requirement: "sigstoreSigned", wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := PolicyRequirement{Type: test.requirement}.check(test.byDigest)
+		if (err != nil) != test.wantErr {
+			t.Errorf("check(%s, byDigest=%v) error = %v, want error %v", test.requirement, test.byDigest, err, test.wantErr)
+		}
+	}
+}
+
+func TestDockerScopes(t *testing.T) {
+	tests := []struct {
+		image string
+		want  []string
+	}{
+		{
+			image: "alpine",
+			want:  []string{"docker.io/library/alpine:latest", "docker.io/library/alpine", "docker.io/library", "docker.io", "*.io"},
+		},
+		{
+			image: "registry.example.com/team/app/api@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			want: []string{
+				"registry.example.com/team/app/api@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+				"registry.example.com/team/app/api",
+				"registry.example.com/team/app",
+				"registry.example.com/team",
+				"registry.example.com",
+				"*.example.com",
+				"*.com",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		ref, err := name.ParseReference(test.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := dockerScopes(ref)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("dockerScopes(%s) = %v, want %v", test.image, got, test.want)
+		}
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	policy := `{
+		"default": [{"type": "reject"}],
+		"transports": {
+			"docker": {
+				"docker.io/library": [{"type": "insecureAcceptAnything"}],
+				"docker.io/library/busybox": [{"type": "reject"}],
+				"registry.example.com/team": [{"type": "dockerlessDigestPinned"}],
+				"*.trusted.com": [{"type": "insecureAcceptAnything"}]
+			},
+			"dir": {
+				"/srv/images": [{"type": "insecureAcceptAnything"}]
+			}
+		}
+	}`
+
+	tests := []struct {
+		image   string
+		wantErr bool
+	}{
+		{image: "alpine:3.18"},
+		{image: "docker.io/library/ubuntu"},
+		{image: "busybox", wantErr: true},
+		{image: "docker.io/someone/app", wantErr: true},
+		{image: "registry.example.com/team/app:v1", wantErr: true},
+		{image: "registry.example.com/team/app@sha256:0000000000000000000000000000000000000000000000000000000000000000"},
+		{image: "registry.example.com/other/app@sha256:0000000000000000000000000000000000000000000000000000000000000000", wantErr: true},
+		{image: "mirror.trusted.com/app"},
+		{image: "dir:/srv/images/rootfs"},
+		{image: "dir:/srv/other/rootfs", wantErr: true},
+	}
+
+	provider := testPolicyProvider(t, policy)
+
+	for _, test := range tests {
+		err := provider.checkImagePolicy(test.image)
+		if (err != nil) != test.wantErr {
+			t.Errorf("checkImagePolicy(%s) error = %v, want error %v", test.image, err, test.wantErr)
+		}
+	}
+}
+
+func TestPolicyValidation(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr string
+	}{
+		{policy: `{"default": [{"type": "insecureAcceptAnything"}]}`},
+		{policy: `{"default": []}`, wantErr: "default policy is empty"},
+		{
+			policy:  `{"default": [{"type": "insecureAcceptAnything"}], "transports": {"docker": {"quay.io": [{"type": "sigstoreSigned"}]}}}`,
+			wantErr: "SIGNATURE_PUBLIC_KEYS",
+		},
+		{policy: `{"default": [{"type": "signedBy"}]}`, wantErr: "SIGNATURE_PUBLIC_KEYS"},
+		{policy: `{"default": [{"type": "digestPinned"}]}`, wantErr: "unsupported requirement type"},
+		{policy: `{"default": `, wantErr: "loading"},
+	}
+
+	for _, test := range tests {
+		_, err := testPolicyProvider(t, test.policy).Policy()
+		if test.wantErr == "" && err != nil {
+			t.Errorf("Policy(%s) error = %v", test.policy, err)
+		}
+
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("Policy(%s) error = %v, want %q", test.policy, err, test.wantErr)
+		}
+	}
+}
+
+func TestNoPolicy(t *testing.T) {
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir()},
+		Log:    log.Discard,
+	}
+
+	err := provider.checkImagePolicy("alpine")
+	if err != nil {
+		t.Errorf("checkImagePolicy(alpine) without policy error = %v", err)
+	}
+}
+
+func TestStartRejectedImage(t *testing.T) {
+	provider := testPolicyProvider(t, `{
+		"default": [{"type": "insecureAcceptAnything"}],
+		"transports": {"docker": {"docker.io/library/busybox": [{"type": "reject"}]}}
+	}`)
+
+	statusDIR := filepath.Join(provider.Config.TargetDir, "status", "workspace")
+
+	err := os.MkdirAll(statusDIR, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(statusDIR, "runOptions"), []byte(`{"image": "index.docker.io/library/busybox:latest"}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the image was allowed when the workspace was created
+	err = provider.Start(context.Background(), "workspace")
+	if err == nil || !strings.Contains(err.Error(), "rejected by policy") {
+		t.Errorf("Start() error = %v, want the image to be rejected", err)
+	}
+}
+
+// testPolicyProvider returns a provider using input policy.json.
+func testPolicyProvider(t *testing.T, policy string) *DockerlessProvider {
+	t.Helper()
+
+	targetDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(targetDir, "policy.json"), []byte(policy), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &DockerlessProvider{
+		Config: &options.Options{TargetDir: targetDir},
+		Log:    log.Discard,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 )
@@ -44,3 +45,39 @@ func GetPid(id string) (int, error) {
 
 	return -1, fmt.Errorf("container %s is not running", id)
 }
+
+// NamespacedCommand will return a command that runs input args in a new set of
+// namespaces for the container with input id.
+// When rootless, rootlesskit is used in order to have a user namespace with
+// the subuid/subgid maps set, else we simply unshare.
+func NamespacedCommand(workspaceId string, args ...string) *exec.Cmd {
+	command := ""
+	var cmdArgs []string
+
+	if os.Getuid() > 0 {
+		command = "rootlesskit"
+		cmdArgs = []string{
+			"--pidns",
+			"--cgroupns",
+			"--utsns",
+			"--ipcns",
+			"--net",
+			"host",
+			"--state-dir",
+			filepath.Join("/tmp", "dockerless", workspaceId),
+		}
+	} else {
+		command = "unshare"
+		cmdArgs = []string{
+			"-m",
+			"-p",
+			"-u",
+			"-f",
+			"--mount-proc",
+		}
+	}
+
+	cmdArgs = append(cmdArgs, args...)
+
+	return exec.Command(command, cmdArgs...)
+}
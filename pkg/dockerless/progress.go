@@ -0,0 +1,149 @@
+package dockerless
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/loft-sh/log"
+)
+
+// progressInterval is how often the pull progress is reported.
+const progressInterval = 2 * time.Second
+
+// pullProgress tracks the bytes downloaded for all the layers of an image.
+type pullProgress struct {
+	start  time.Time
+	total  atomic.Int64
+	layers []*layerProgress
+}
+
+// layerProgress tracks the bytes downloaded for a single layer.
+// Resumed bytes were downloaded by a previous pull, they are part of
+// downloaded but not of the throughput.
+type layerProgress struct {
+	index      int
+	count      int
+	size       int64
+	downloaded atomic.Int64
+	resumed    atomic.Int64
+	active     atomic.Bool
+	done       atomic.Bool
+}
+
+// progressReader counts the bytes read into a layerProgress.
+type progressReader struct {
+	io.Reader
+	progress *layerProgress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.progress.downloaded.Add(int64(n))
+
+	return n, err
+}
+
+func newPullProgress(sizes []int64) *pullProgress {
+	progress := &pullProgress{start: time.Now()}
+
+	for index, size := range sizes {
+		progress.total.Add(size)
+		progress.layers = append(progress.layers, &layerProgress{
+			index: index + 1,
+			count: len(sizes),
+			size:  size,
+		})
+	}
+
+	return progress
+}
+
+// reader wraps input reader in order to account the bytes read to the layer.
+func (l *layerProgress) reader(reader io.Reader) io.Reader {
+	l.active.Store(true)
+
+	return &progressReader{Reader: reader, progress: l}
+}
+
+// resume accounts the bytes of a partial download resumed from offset.
+func (l *layerProgress) resume(offset int64) {
+	l.downloaded.Add(offset)
+	l.resumed.Add(offset)
+}
+
+// skip marks the layer as not needing to be downloaded.
+func (p *pullProgress) skip(layer *layerProgress) {
+	p.total.Add(-layer.size)
+	layer.done.Store(true)
+}
+
+// finish marks the layer as downloaded.
+func (p *pullProgress) finish(layer *layerProgress, logger log.Logger) {
+	layer.active.Store(false)
+	layer.done.Store(true)
+
+	logger.Infof("downloaded layer %d of %d (%s)", layer.index, layer.count, units.HumanSize(float64(layer.size)))
+}
+
+// run will report the progress every progressInterval, until ctx is done.
+func (p *pullProgress) run(ctx context.Context, logger log.Logger) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.report(logger)
+		}
+	}
+}
+
+func (p *pullProgress) report(logger log.Logger) {
+	var downloaded int64
+
+	for _, layer := range p.layers {
+		current := layer.downloaded.Load()
+		downloaded += current
+
+		if layer.active.Load() && !layer.done.Load() {
+			logger.Infof("layer %d of %d: %s of %s",
+				layer.index,
+				layer.count,
+				units.HumanSize(float64(current)),
+				units.HumanSize(float64(layer.size)),
+			)
+		}
+	}
+
+	total := p.total.Load()
+	throughput := p.throughput(time.Since(p.start))
+
+	eta := "unknown"
+	if throughput > 0 && total >= downloaded {
+		eta = (time.Duration(float64(total-downloaded)/throughput) * time.Second).Round(time.Second).String()
+	}
+
+	logger.Infof("downloaded %s of %s (%s/s, ETA %s)",
+		units.HumanSize(float64(downloaded)),
+		units.HumanSize(float64(total)),
+		units.HumanSize(throughput),
+		eta,
+	)
+}
+
+// throughput returns the bytes per second downloaded by this pull in elapsed,
+// leaving out the resumed ones.
+func (p *pullProgress) throughput(elapsed time.Duration) float64 {
+	var transferred int64
+
+	for _, layer := range p.layers {
+		transferred += layer.downloaded.Load() - layer.resumed.Load()
+	}
+
+	return float64(transferred) / elapsed.Seconds()
+}
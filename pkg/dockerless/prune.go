@@ -0,0 +1,279 @@
+package dockerless
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/go-units"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+)
+
+// PruneImages will remove the images not referenced by any workspace, and the
+// blobs not referenced by any remaining image from the store.
+// By default only dangling images are removed, that is manifests no longer
+// pointed to by a reference, if all is set every image not used by a
+// workspace is removed too.
+// If dryRun is set, nothing is removed and only a report is produced.
+func (p *DockerlessProvider) PruneImages(ctx context.Context, dryRun, all bool) error {
+	action := "removed"
+	if dryRun {
+		action = "would remove"
+	}
+
+	// pulls write blobs before index.json references them
+	unlock, err := p.LockStore(true)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	store, err := p.openStore()
+	if err != nil {
+		return err
+	}
+
+	used, err := p.WorkspaceImages()
+	if err != nil {
+		return err
+	}
+
+	pinned, err := p.WorkspaceDigests()
+	if err != nil {
+		return err
+	}
+
+	images, err := p.ListImages()
+	if err != nil {
+		return err
+	}
+
+	// first the references
+	kept := map[string]bool{}
+	for _, image := range images {
+		if _, ok := used[image]; ok || !all {
+			kept[image] = true
+
+			continue
+		}
+
+		p.Log.Infof("%s image %s", action, image)
+
+		if dryRun {
+			continue
+		}
+
+		err = p.removeImageDir(image)
+		if err != nil {
+			return err
+		}
+	}
+
+	index, err := store.ImageIndex()
+	if err != nil {
+		return err
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	// then the manifests no reference points to anymore, unless
+	// a workspace was created from them
+	live := map[string]bool{}
+	removed := []match.Matcher{}
+
+	for _, desc := range indexManifest.Manifests {
+		image := desc.Annotations[refNameAnnotation]
+
+		if !kept[image] && !pinned[desc.Digest.String()] {
+			if image == "" {
+				p.Log.Infof("%s dangling manifest %s", action, desc.Digest.String())
+			}
+
+			// other references may point to the same manifest
+			removed = append(removed, matchDescriptor(desc.Digest, image))
+
+			continue
+		}
+
+		err = p.markManifest(desc.Digest, live)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(removed) > 0 && !dryRun {
+		err = updateIndex(store, func(manifests []v1.Descriptor) []v1.Descriptor {
+			remaining := []v1.Descriptor{}
+
+			for _, desc := range manifests {
+				if !matchAny(removed, desc) {
+					remaining = append(remaining, desc)
+				}
+			}
+
+			return remaining
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the images' own manifests are always kept, in case the index is out of date
+	for image := range kept {
+		manifest, err := readImageManifest(p.ImageDir(image))
+		if err != nil {
+			continue
+		}
+
+		digest, err := imageDigest(p.ImageDir(image))
+		if err == nil {
+			live[digest.String()] = true
+		}
+
+		markBlobs(manifest, live)
+	}
+
+	// and finally the blobs
+	blobsDIR := filepath.Join(p.StoreDir(), "blobs", "sha256")
+
+	blobs, err := os.ReadDir(blobsDIR)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var reclaimed int64
+
+	for _, blob := range blobs {
+		if live["sha256:"+blob.Name()] {
+			continue
+		}
+
+		info, err := blob.Info()
+		if err != nil {
+			return err
+		}
+
+		p.Log.Debugf("%s blob sha256:%s", action, blob.Name())
+
+		reclaimed += info.Size()
+
+		if dryRun {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(blobsDIR, blob.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	// extracted layers are only kept while a workspace uses them
+	unusedLayers, err := p.unusedLayerDirs()
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range unusedLayers {
+		p.Log.Infof("%s extracted layer %s:%s", action, filepath.Base(filepath.Dir(dir)), filepath.Base(dir))
+	}
+
+	// and base rootfs while their image is kept
+	keptDigests := map[string]bool{}
+	for image := range kept {
+		digest, err := imageDigest(p.ImageDir(image))
+		if err == nil {
+			keptDigests[digest.String()] = true
+		}
+	}
+
+	unusedBases, err := p.unusedBaseDirs(keptDigests)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range unusedBases {
+		p.Log.Infof("%s base rootfs %s:%s", action, filepath.Base(filepath.Dir(dir)), filepath.Base(dir))
+	}
+
+	unusedDirs := append(unusedLayers, unusedBases...)
+	for _, dir := range unusedDirs {
+		reclaimed += dirSize(dir)
+	}
+
+	if len(unusedDirs) > 0 && !dryRun {
+		// their files belong to the users of the container's user namespace
+		cmd := NamespacedCommand("prune", append([]string{"rm", "-rf"}, unusedDirs...)...)
+
+		err = cmd.Run()
+		if err != nil {
+			return fmt.Errorf("removing extracted layers and rootfs: %w", err)
+		}
+	}
+
+	if dryRun {
+		p.Log.Infof("would reclaim %s", units.HumanSize(float64(reclaimed)))
+	} else {
+		p.Log.Infof("reclaimed %s", units.HumanSize(float64(reclaimed)))
+	}
+
+	return nil
+}
+
+// markManifest will mark as live the manifest with input digest and all the blobs it references.
+func (p *DockerlessProvider) markManifest(digest v1.Hash, live map[string]bool) error {
+	live[digest.String()] = true
+
+	rawManifest, err := os.ReadFile(p.BlobPath(digest))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	manifest := &v1.Manifest{}
+
+	err = json.Unmarshal(rawManifest, manifest)
+	if err != nil {
+		return err
+	}
+
+	markBlobs(manifest, live)
+
+	return nil
+}
+
+// matchDescriptor matches the index.json entries with input digest and reference,
+// empty for dangling ones.
+func matchDescriptor(digest v1.Hash, image string) match.Matcher {
+	return func(desc v1.Descriptor) bool {
+		return desc.Digest == digest && desc.Annotations[refNameAnnotation] == image
+	}
+}
+
+// matchAny returns whether input descriptor is matched by any of input matchers.
+func matchAny(matchers []match.Matcher, desc v1.Descriptor) bool {
+	for _, matcher := range matchers {
+		if matcher(desc) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func markBlobs(manifest *v1.Manifest, live map[string]bool) {
+	live[manifest.Config.Digest.String()] = true
+
+	for _, layer := range manifest.Layers {
+		live[layer.Digest.String()] = true
+	}
+}
@@ -2,51 +2,192 @@ package dockerless
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/docker/go-units"
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
 	"github.com/loft-sh/devpod/pkg/driver"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
 )
 
-// Pull will pull a given image and save it to ImageDir.
+// Pull will pull a given image and save it to ImageDir, following the PULL_POLICY option.
 // This function uses github.com/google/go-containerregistry/pkg/crane to pull
 // the image's manifest, and performs the downloading of each layer separately.
-// Each layer is deduplicated between images in order to save space, using hardlinks.
+// Layers are stored in a content-addressed OCI image layout shared by all the images,
+// in order to save space, while manifest.json, config.json and image_name are kept
+// in the image's own directory.
 func (p *DockerlessProvider) Pull(ctx context.Context, runOptions *driver.RunOptions) error {
+	// images with a transport prefix, eg oci:/path:tag, are imported
+	// from the local filesystem instead
+	imported := parseImportReference(runOptions.Image)
+
 	// First we try to get the fully qualified uri of the image
 	// eg alpine:latest -> index.docker.io/library/alpine:latest
-	image := runOptions.Image
-	ref, err := name.ParseReference(image)
-	if err == nil {
-		image = ref.Name()
+	// unqualified images may resolve to any of the search registries
+	refs, err := p.candidateImages(runOptions.Image, imported)
+	if err != nil {
+		return err
+	}
+
+	platform, err := p.Platform()
+	if err != nil {
+		return err
+	}
+
+	// if public keys are configured, only images signed with one of them are pulled
+	keys, err := p.signatureKeys()
+	if err != nil {
+		return err
 	}
 
-	targetDIR := filepath.Join(p.Config.TargetDir, "images", ref.Name())
+	// prefer the first candidate already stored locally
+	ref := refs[0]
+	localDigest, found := v1.Hash{}, false
+
+	for _, candidate := range refs {
+		localDigest, found = p.localImage(p.ImageDir(candidate.Name()), platform)
+		if found {
+			ref = candidate
+			refs = []name.Reference{candidate}
+
+			break
+		}
+	}
+
+	// the fully qualified name is used from now on, so that
+	// the workspace refers to the image that was resolved,
+	// and imported images to their local name instead of a relative path
+	runOptions.Image = ref.Name()
+
+	// images stored before the keys were configured have to be verified
+	verified := len(keys) == 0 || (found && isVerifiedWith(p.ImageDir(ref.Name()), localDigest, keys))
+
+	// committed and tagged images are never looked up in a registry
+	if imported == nil && isLocalImage(ref) {
+		return p.localOnlyImage(ref, platform, found, verified)
+	}
+
+	switch p.Config.PullPolicy {
+	case options.PullPolicyNever:
+		if !found {
+			return fmt.Errorf("image %s not found locally for %s and pull policy is %s", ref.Name(), platform.String(), options.PullPolicyNever)
+		}
+
+		if !verified {
+			return fmt.Errorf("signature of image %s was not verified and pull policy is %s", ref.Name(), options.PullPolicyNever)
+		}
 
-	p.Log.Infof("downloading %s", ref.Name())
-	// if we already downloaded the image, exit
-	_, err = os.Stat(filepath.Join(targetDIR, "manifest.json"))
-	if err == nil {
 		p.Log.Infof("image %s already found", ref.Name())
 
 		return nil
+	case options.PullPolicyMissing:
+		// if we already downloaded the image for the same platform, exit
+		if found && verified {
+			p.Log.Infof("image %s already found", ref.Name())
+
+			return nil
+		}
+	}
+
+	if imported != nil {
+		return p.importImage(ctx, imported, ref, platform, keys, found, localDigest)
 	}
 
-	p.Log.Debugf("getting info about %s", ref.Name())
-	// Pull will just get us the v1.Image struct, from
+	p.Log.Infof("downloading %s", runOptions.Image)
+
+	p.Log.Debugf("getting info about %s", runOptions.Image)
+	// Get will just get us the descriptor of the image, from
 	// which we get all the information we need
-	imageManifest, err := crane.Pull(image)
+	keychain, err := p.Keychain()
+	if err != nil {
+		return err
+	}
+
+	desc, ref, source, err := p.getImage(ctx, refs, platform, keychain)
+	if err != nil {
+		return err
+	}
+
+	runOptions.Image = ref.Name()
+	image := ref.Name()
+	targetDIR := p.ImageDir(image)
+
+	imageManifest, err := desc.Image()
 	if err != nil {
 		return err
 	}
 
+	// with the always policy, only download if the tag moved
+	remoteDigest, err := imageManifest.Digest()
+	if err != nil {
+		return err
+	}
+
+	// the signature is verified before anything is written
+	var verification *SignatureVerification
+
+	if len(keys) > 0 {
+		p.Log.Debugf("verifying signature of %s", ref.Name())
+
+		verification, err = p.verifySignature(
+			ref,
+			source.ref.Context(),
+			remoteDigest,
+			desc.Digest,
+			keys,
+			p.remoteOptions(ctx, source, platform, keychain),
+		)
+		if err != nil {
+			return err
+		}
+
+		p.Log.Infof("signature of %s verified with %s", ref.Name(), verification.Key)
+	}
+
+	if found && remoteDigest == localDigest {
+		err = saveSignatureVerification(targetDIR, verification)
+		if err != nil {
+			return err
+		}
+
+		p.Log.Infof("image %s is up to date", ref.Name())
+
+		return nil
+	}
+
+	// used to resume interrupted downloads, if unavailable
+	// layers are downloaded from scratch
+	fetcher, err := newBlobFetcher(ctx, source.ref.Context(), keychain, source.transport)
+	if err != nil {
+		p.Log.Debugf("downloads of %s will not be resumable: %v", ref.Name(), err)
+	}
+
+	return p.saveImage(ctx, image, imageManifest, fetcher, verification)
+}
+
+// saveImage will download the layers of input image in the store, then save its
+// manifest.json, config.json and image_name in its own directory.
+// The fetcher, if any, is used to resume interrupted layer downloads.
+func (p *DockerlessProvider) saveImage(
+	ctx context.Context,
+	image string,
+	imageManifest v1.Image,
+	fetcher *blobFetcher,
+	verification *SignatureVerification,
+) error {
+	targetDIR := p.ImageDir(image)
+
 	p.Log.Debugf("preparing to get layers")
 	// We get the layers
 	layers, err := imageManifest.Layers()
@@ -54,40 +195,56 @@ func (p *DockerlessProvider) Pull(ctx context.Context, runOptions *driver.RunOpt
 		return err
 	}
 
-	// Prepare the image path
-	if !Exist(targetDIR) {
-		err := os.MkdirAll(targetDIR, os.ModePerm)
+	// fail before downloading anything if a layer cannot be unpacked
+	for _, layer := range layers {
+		mediaType, err := layer.MediaType()
 		if err != nil {
 			return err
 		}
+
+		err = CheckLayerMediaType(mediaType)
+		if err != nil {
+			return fmt.Errorf("image %s: %w", image, err)
+		}
 	}
 
-	p.Log.Infof("downloading layers")
-	keepFiles := []string{}
-	// Now we download the layers
-	for index, layer := range layers {
-		p.Log.Infof("downloading layer %d of %d", index+1, len(layers))
+	// blobs not referenced by index.json yet must survive a concurrent prune
+	unlock, err := p.LockStore(false)
+	if err != nil {
+		return err
+	}
 
-		fileName, err := downloadLayer(targetDIR, layer)
+	defer unlock()
+
+	// Prepare the image path
+	if !Exist(targetDIR) {
+		err := os.MkdirAll(targetDIR, os.ModePerm)
 		if err != nil {
 			return err
 		}
+	}
+
+	store, err := p.openStore()
+	if err != nil {
+		return err
+	}
 
-		keepFiles = append(keepFiles, fileName)
+	err = p.downloadLayers(ctx, targetDIR, layers, fetcher)
+	if err != nil {
+		return err
 	}
 
+	p.Log.Debugf("cleaning up image dir")
+	// layers from older versions were stored inside the image dir,
+	// they now live in the store
 	fileList, err := os.ReadDir(targetDIR)
 	if err != nil {
 		return err
 	}
 
-	p.Log.Debugf("cleaning up image dir")
 	for _, file := range fileList {
-		if !strings.Contains(
-			strings.Join(keepFiles, ":"),
-			filepath.Base(file.Name()),
-		) {
-			err = os.Remove(filepath.Join(targetDIR, file.Name()))
+		if strings.HasSuffix(file.Name(), ".tar.gz") || file.Name() == ".temp" {
+			err = os.RemoveAll(filepath.Join(targetDIR, file.Name()))
 			if err != nil {
 				return err
 			}
@@ -128,90 +285,467 @@ func (p *DockerlessProvider) Pull(ctx context.Context, runOptions *driver.RunOpt
 		return err
 	}
 
+	err = saveSignatureVerification(targetDIR, verification)
+	if err != nil {
+		return err
+	}
+
+	p.Log.Debugf("saving image to the store")
+	// the store's index.json tracks which manifest the reference points to
+	err = storeImage(store, image, imageManifest)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// downloadLayer will download input layer into targetDIR.
-// downloadLayer will first searc hexisting images inside the ImageDir in order
-// to find matching layers, and hardlink them in order to save disk space.
-//
-// Each layer download is verified in order to ensure no corrupted downloads occur.
-func downloadLayer(targetDIR string, layer v1.Layer) (string, error) {
-	// we use this as a path to download layers, in order to
-	// verify them and ensure we do not leave broken files
-	tmpdir := filepath.Join(targetDIR, ".temp")
+// candidateImages returns the references input image may refer to, allowed by policy.json.
+// Imported images have a single one, their local name.
+func (p *DockerlessProvider) candidateImages(image string, imported *importReference) ([]name.Reference, error) {
+	if imported != nil {
+		err := p.checkImportPolicy(imported)
+		if err != nil {
+			return nil, err
+		}
+
+		ref, err := name.ParseReference(imported.localName())
+		if err != nil {
+			return nil, fmt.Errorf("importing %s: %w", imported.String(), err)
+		}
+
+		return []name.Reference{ref}, nil
+	}
 
-	// always cleanup before
-	_ = os.RemoveAll(tmpdir)
+	// committed and tagged images come before the registries
+	if isUnqualified(image) {
+		ref, err := localImageName(image)
+		if err == nil && ref.Name() == p.storedName(image) {
+			return p.allowedImages([]name.Reference{ref})
+		}
+	}
 
-	err := os.MkdirAll(tmpdir, 0o750)
+	refs, err := p.ResolveImage(image)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// and after
-	defer func() { _ = os.RemoveAll(tmpdir) }()
+	// only consider the candidates allowed by policy.json
+	return p.allowedImages(refs)
+}
+
+// localOnlyImage checks that input image of the local registry, which cannot be pulled,
+// is stored for input platform.
+func (p *DockerlessProvider) localOnlyImage(ref name.Reference, platform *v1.Platform, found, verified bool) error {
+	if !found {
+		return fmt.Errorf("image %s not found locally for %s, images of %s are only created by commit and tag", ref.Name(), platform.String(), LocalRegistry)
+	}
+
+	// signatures are only stored in registries
+	if !verified {
+		return fmt.Errorf("signature of image %s cannot be verified, only images pulled from registries can", ref.Name())
+	}
+
+	p.Log.Infof("image %s already found", ref.Name())
+
+	return nil
+}
 
-	layerDigest, _ := layer.Digest()
+// importImage will import input image from the local filesystem into the store,
+// under its local name ref, the same way pulled images are stored.
+func (p *DockerlessProvider) importImage(
+	ctx context.Context,
+	imported *importReference,
+	ref name.Reference,
+	platform *v1.Platform,
+	keys []publicKey,
+	found bool,
+	localDigest v1.Hash,
+) error {
+	// signatures are only stored in registries
+	if len(keys) > 0 {
+		return fmt.Errorf("signature of image %s cannot be verified, only images pulled from registries can", imported.String())
+	}
 
-	layerFileName := strings.Split(layerDigest.String(), ":")[1] + ".tar.gz"
+	p.Log.Infof("importing %s", imported.String())
 
-	// If a layer already exists, exit
-	if Exist(filepath.Join(targetDIR, layerFileName)) &&
-		CheckFileDigest(filepath.Join(targetDIR, layerFileName), layerDigest.String()) {
-		return layerFileName, nil
+	err := os.MkdirAll(p.ingestDir(), 0o750)
+	if err != nil {
+		return err
 	}
 
-	// But if a layer with the same name/digest exists in another directory
-	// let's deduplicate the disk usage by using hardlinks
-	matchingLayers := findExistingLayer(filepath.Dir(targetDIR), layerFileName)
-	if len(matchingLayers) > 0 &&
-		CheckFileDigest(matchingLayers[0], layerDigest.String()) {
-		return layerFileName, os.Link(matchingLayers[0], filepath.Join(targetDIR, layerFileName))
+	tempDir, err := os.MkdirTemp(p.ingestDir(), "import-")
+	if err != nil {
+		return err
 	}
 
-	// Else we proceed with the download of the layer
-	savedLayer, err := os.Create(filepath.Join(tmpdir, layerFileName))
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	imageManifest, err := imported.image(platform, tempDir)
 	if err != nil {
-		return "", err
+		return err
 	}
 
+	digest, err := imageManifest.Digest()
+	if err != nil {
+		return err
+	}
+
+	if found && digest == localDigest {
+		p.Log.Infof("image %s is up to date", ref.Name())
+
+		return nil
+	}
+
+	return p.saveImage(ctx, ref.Name(), imageManifest, nil, nil)
+}
+
+// remoteOptions returns the options used to get images from input source.
+func (p *DockerlessProvider) remoteOptions(
+	ctx context.Context,
+	source *pullSource,
+	platform *v1.Platform,
+	keychain authn.Keychain,
+) []remote.Option {
+	craneOptions := crane.GetOptions(
+		crane.WithPlatform(platform),
+		crane.WithContext(ctx),
+		crane.WithAuthFromKeychain(keychain),
+		crane.WithTransport(source.transport),
+	)
+
+	return craneOptions.Remote
+}
+
+// allowedImages returns which of input references are allowed by policy.json,
+// or the policy violation if none is.
+func (p *DockerlessProvider) allowedImages(refs []name.Reference) ([]name.Reference, error) {
+	allowed := []name.Reference{}
+
+	var policyErr error
+
+	for _, ref := range refs {
+		err := p.CheckPolicy(ref)
+		if err != nil {
+			if policyErr == nil {
+				policyErr = err
+			}
+
+			continue
+		}
+
+		allowed = append(allowed, ref)
+	}
+
+	if len(allowed) == 0 {
+		return nil, policyErr
+	}
+
+	return allowed, nil
+}
+
+// getImage returns the descriptor of the first of input references found for
+// input platform, with the reference and the source it was found at.
+// Each reference is looked up in its mirrors first, following registries.conf.
+func (p *DockerlessProvider) getImage(
+	ctx context.Context,
+	refs []name.Reference,
+	platform *v1.Platform,
+	keychain authn.Keychain,
+) (*remote.Descriptor, name.Reference, *pullSource, error) {
+	registriesConfig, err := p.RegistriesConfig()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var lastErr error
+
+	for _, ref := range refs {
+		sources, err := registriesConfig.pullSources(ref)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		for _, source := range sources {
+			source := source
+
+			source.transport, err = p.registryTransport(source.ref.Context().Registry, source.insecure)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			desc, err := remote.Get(source.ref, p.remoteOptions(ctx, &source, platform, keychain)...)
+			if err == nil {
+				err = checkPlatform(ref, desc, platform)
+			}
+
+			if err != nil {
+				p.Log.Debugf("cannot get %s from %s: %v", ref.Name(), source.ref.Context().RegistryStr(), err)
+
+				lastErr = err
+
+				continue
+			}
+
+			if source.ref.Name() != ref.Name() {
+				p.Log.Infof("pulling %s from %s", ref.Name(), source.ref.Name())
+			}
+
+			return desc, ref, &source, nil
+		}
+	}
+
+	if len(refs) > 1 {
+		names := []string{}
+		for _, ref := range refs {
+			names = append(names, ref.Name())
+		}
+
+		return nil, nil, nil, fmt.Errorf("image not found as any of %s: %w", strings.Join(names, ", "), lastErr)
+	}
+
+	return nil, nil, nil, lastErr
+}
+
+// localImage returns the digest of the image stored in imageDir, and whether it
+// is complete and matches input platform.
+func (p *DockerlessProvider) localImage(imageDir string, platform *v1.Platform) (v1.Hash, bool) {
+	imageConfig, err := readImageConfig(imageDir)
+	if err != nil || imageConfig.Platform() == nil || !imageConfig.Platform().Satisfies(*platform) {
+		return v1.Hash{}, false
+	}
+
+	manifest, err := readImageManifest(imageDir)
+	if err != nil || !p.hasLayers(manifest) {
+		return v1.Hash{}, false
+	}
+
+	digest, err := imageDigest(imageDir)
+	if err != nil {
+		return v1.Hash{}, false
+	}
+
+	return digest, true
+}
+
+// downloadLayers will download input layers into the store concurrently,
+// up to PULL_CONCURRENCY at a time, reporting the progress.
+func (p *DockerlessProvider) downloadLayers(ctx context.Context, imageDir string, layers []v1.Layer, fetcher *blobFetcher) error {
+	sizes := []int64{}
+
+	for _, layer := range layers {
+		size, err := layer.Size()
+		if err != nil {
+			return err
+		}
+
+		sizes = append(sizes, size)
+	}
+
+	progress := newPullProgress(sizes)
+
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	defer stopProgress()
+
+	go progress.run(progressCtx, p.Log)
+
+	p.Log.Infof("downloading %d layers, %d at a time", len(layers), p.Config.PullConcurrency)
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(p.Config.PullConcurrency)
+
+	for index, layer := range layers {
+		layer := layer
+		layerProgress := progress.layers[index]
+
+		group.Go(func() error {
+			if groupCtx.Err() != nil {
+				return groupCtx.Err()
+			}
+
+			downloaded, err := p.downloadLayer(groupCtx, imageDir, layer, fetcher, layerProgress)
+			if err != nil {
+				return err
+			}
+
+			if downloaded {
+				progress.finish(layerProgress, p.Log)
+			} else {
+				progress.skip(layerProgress)
+			}
+
+			return nil
+		})
+	}
+
+	err := group.Wait()
+	if err != nil {
+		return err
+	}
+
+	stopProgress()
+	progress.report(p.Log)
+
+	return nil
+}
+
+// downloadLayer will download input layer into the store.
+// Returns whether the layer had to be downloaded.
+// As the store is content-addressed, a layer already present is never downloaded
+// twice, whichever image it was pulled for.
+//
+// Partial downloads are kept in the ingest dir, and resumed from where they
+// stopped if the registry supports range requests.
+//
+// Each layer download is verified in order to ensure no corrupted downloads occur.
+func (p *DockerlessProvider) downloadLayer(
+	ctx context.Context,
+	imageDir string,
+	layer v1.Layer,
+	fetcher *blobFetcher,
+	progress *layerProgress,
+) (bool, error) {
+	layerDigest, err := layer.Digest()
+	if err != nil {
+		return false, err
+	}
+
+	blobPath := p.BlobPath(layerDigest)
+
+	// If a layer already exists, exit. Blobs are verified before entering the store.
+	if Exist(blobPath) {
+		return false, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(blobPath), os.ModePerm)
+	if err != nil {
+		return false, err
+	}
+
+	// Layers downloaded by older versions live in the image dir, move them
+	// in the store instead of downloading them again
+	legacyLayer := filepath.Join(imageDir, layerDigest.Hex+".tar.gz")
+	if Exist(legacyLayer) && CheckFileDigest(legacyLayer, layerDigest.String()) {
+		return false, os.Rename(legacyLayer, blobPath)
+	}
+
+	// we use this as a path to download layers, in order to
+	// verify them and ensure we do not leave broken files
+	err = os.MkdirAll(p.ingestDir(), 0o750)
+	if err != nil {
+		return false, err
+	}
+
+	partialPath := filepath.Join(p.ingestDir(), layerDigest.Hex)
+
+	savedLayer, err := os.OpenFile(partialPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return false, err
+	}
+
+	// closing the file releases the lock
 	defer func() { _ = savedLayer.Close() }()
 
-	tarLayer, err := layer.Compressed()
+	// concurrent pulls of the same layer share the partial download, the first
+	// one holding the lock downloads it while the others wait for it
+	err = unix.Flock(int(savedLayer.Fd()), unix.LOCK_EX)
 	if err != nil {
-		return "", err
+		return false, fmt.Errorf("locking %s: %w", partialPath, err)
+	}
+
+	// downloaded while waiting, opening the partial download created it again
+	if Exist(blobPath) {
+		err = os.Remove(partialPath)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+
+		return false, nil
 	}
 
-	_, err = io.Copy(savedLayer, tarLayer)
+	// the size of the partial download is the offset to resume from
+	offset, err := savedLayer.Seek(0, io.SeekEnd)
 	if err != nil {
-		return "", err
+		return false, err
 	}
 
+	var tarLayer io.ReadCloser
+
+	resumed := false
+
+	if offset > 0 && fetcher != nil {
+		tarLayer, resumed, err = fetcher.fetch(ctx, layerDigest, offset)
+		if err != nil {
+			p.Log.Debugf("cannot resume layer %s: %v", layerDigest.String(), err)
+		}
+	}
+
+	if tarLayer == nil {
+		tarLayer, err = layer.Compressed()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	defer func() { _ = tarLayer.Close() }()
+
 	// always verify if the download was correctly done by
-	// checking the digest of the file
-	if CheckFileDigest(filepath.Join(tmpdir, layerFileName), layerDigest.String()) {
-		err = os.Rename(filepath.Join(tmpdir, layerFileName),
-			filepath.Join(targetDIR, layerFileName))
+	// checking the digest of the content while writing it
+	hasher := sha256.New()
+
+	if resumed {
+		p.Log.Infof("resuming layer %d of %d from %s", progress.index, progress.count, units.HumanSize(float64(offset)))
+
+		// the content already downloaded is part of the digest
+		_, err = savedLayer.Seek(0, io.SeekStart)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = io.Copy(hasher, savedLayer)
+		if err != nil {
+			return false, err
+		}
 
-		return layerFileName, err
+		progress.resume(offset)
+	} else {
+		err = savedLayer.Truncate(0)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = savedLayer.Seek(0, io.SeekStart)
+		if err != nil {
+			return false, err
+		}
 	}
 
-	return "", fmt.Errorf("error getting layer")
-}
+	// on error the partial download is kept, to be resumed by the next pull
+	_, err = io.Copy(io.MultiWriter(savedLayer, hasher), progress.reader(tarLayer))
+	if err != nil {
+		return false, err
+	}
 
-// findExistingLayer is useful to find layers with matching name/digest in order to
-// deduplicate disk usage by using hardlinks later.
-func findExistingLayer(targetDIR, filename string) []string {
-	var matchingFiles []string
+	if fmt.Sprintf("%x", hasher.Sum(nil)) != layerDigest.Hex {
+		_ = os.Remove(partialPath)
 
-	_ = filepath.WalkDir(targetDIR, func(name string, dirEntry fs.DirEntry, err error) error {
-		if dirEntry.Name() == filename {
-			matchingFiles = append(matchingFiles, name)
+		return false, fmt.Errorf("error getting layer %s: digest mismatch", layerDigest.String())
+	}
+
+	err = savedLayer.Sync()
+	if err != nil {
+		return false, err
+	}
+
+	// renamed while still locked, so that waiting pulls find the blob
+	err = os.Rename(partialPath, blobPath)
+	if err != nil {
+		if os.IsNotExist(err) && CheckFileDigest(blobPath, layerDigest.String()) {
+			return false, nil
 		}
 
-		return nil
-	})
+		return false, err
+	}
 
-	return matchingFiles
+	return true, nil
 }
@@ -0,0 +1,317 @@
+package dockerless
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/log"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestDownloadLayerConcurrently(t *testing.T) {
+	content := make([]byte, 4*1024*1024)
+
+	_, err := rand.Read(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(compressed)
+
+	_, err = gzipWriter.Write(content)
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(compressed.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layerDigest, err := layer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir()},
+		Log:    log.Discard,
+	}
+
+	// a partial download left by an interrupted pull, that cannot be resumed
+	err = os.MkdirAll(provider.ingestDir(), 0o750)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(provider.ingestDir(), layerDigest.Hex), compressed.Bytes()[:1024], 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, ctx := errgroup.WithContext(context.Background())
+
+	for index := 0; index < 8; index++ {
+		group.Go(func() error {
+			_, err := provider.downloadLayer(ctx, t.TempDir(), layer, nil, &layerProgress{})
+
+			return err
+		})
+	}
+
+	err = group.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !CheckFileDigest(provider.BlobPath(layerDigest), layerDigest.String()) {
+		t.Fatal("downloaded blob does not match its digest")
+	}
+
+	// the pulls that waited for the download leave no partial download behind
+	if Exist(filepath.Join(provider.ingestDir(), layerDigest.Hex)) {
+		t.Error("a partial download of the blob was left in the ingest directory")
+	}
+}
+
+func TestPullProgressThroughput(t *testing.T) {
+	progress := newPullProgress([]int64{100 << 20, 10 << 20})
+
+	// half of the first layer was downloaded by a previous pull
+	progress.layers[0].resume(50 << 20)
+
+	_, err := io.Copy(io.Discard, progress.layers[0].reader(bytes.NewReader(make([]byte, 2<<20))))
+	if err == nil {
+		_, err = io.Copy(io.Discard, progress.layers[1].reader(bytes.NewReader(make([]byte, 2<<20))))
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if throughput := progress.throughput(2 * time.Second); throughput != 2<<20 {
+		t.Errorf("throughput() = %.0f bytes/s, want %d", throughput, 2<<20)
+	}
+
+	if downloaded := progress.layers[0].downloaded.Load(); downloaded != 52<<20 {
+		t.Errorf("layer downloaded %d bytes, want %d", downloaded, 52<<20)
+	}
+}
+
+func TestPullRelativeImport(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := layout.Write(filepath.Join(dir, "layout"), empty.Index)
+	if err == nil {
+		err = store.AppendImage(testImage(t, 0))
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = os.Chdir(workDir) })
+
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir(), PullPolicy: options.PullPolicyMissing},
+		Log:    log.Discard,
+	}
+
+	runOptions := &driver.RunOptions{Image: "oci:./layout"}
+
+	err = provider.Pull(context.Background(), runOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the workspace refers to the same image whatever the directory it is started from
+	want := parseImportReference("oci:" + filepath.Join(dir, "layout")).localName()
+	if runOptions.Image != want {
+		t.Errorf("image of the run options = %s, want %s", runOptions.Image, want)
+	}
+
+	if !Exist(provider.ImageDir(runOptions.Image)) {
+		t.Errorf("image %s is not stored", runOptions.Image)
+	}
+}
+
+func TestPullPolicy(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	ref, err := name.NewTag(registry.host() + "/team/app:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := testLayerImage(t, 0), testLayerImage(t, 1)
+	registry.push(t, ref, first)
+
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir(), PullConcurrency: 1},
+		Log:    log.Discard,
+	}
+
+	pull := func(policy string) error {
+		provider.Config.PullPolicy = policy
+
+		return provider.Pull(context.Background(), &driver.RunOptions{Image: ref.Name()})
+	}
+
+	// nothing is stored yet
+	err = pull(options.PullPolicyNever)
+	if err == nil || !strings.Contains(err.Error(), "not found locally") || !strings.Contains(err.Error(), "pull policy is never") {
+		t.Errorf("Pull() with policy never error = %v, want image not found locally", err)
+	}
+
+	if registry.count("/v2/team/app/manifests/latest") != 0 {
+		t.Errorf("Pull() with policy never requested the registry")
+	}
+
+	err = pull(options.PullPolicyMissing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStoredDigest(t, provider, ref, first)
+
+	firstLayer := testLayerPath(t, ref, first)
+	if count := registry.count(firstLayer); count != 1 {
+		t.Errorf("layer downloaded %d times, want once", count)
+	}
+
+	// a stored image is neither looked up nor downloaded again
+	manifests := registry.count("/v2/team/app/manifests/latest")
+
+	for _, policy := range []string{options.PullPolicyMissing, options.PullPolicyNever} {
+		err = pull(policy)
+		if err != nil {
+			t.Errorf("Pull() with policy %s error = %v", policy, err)
+		}
+	}
+
+	if count := registry.count("/v2/team/app/manifests/latest"); count != manifests {
+		t.Errorf("Pull() of a stored image requested the manifest %d times", count-manifests)
+	}
+
+	// always only downloads if the remote digest changed
+	err = pull(options.PullPolicyAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if registry.count("/v2/team/app/manifests/latest") == manifests {
+		t.Errorf("Pull() with policy always did not look the remote digest up")
+	}
+
+	if count := registry.count(firstLayer); count != 1 {
+		t.Errorf("Pull() with policy always and an unchanged digest downloaded the layer again")
+	}
+
+	registry.push(t, ref, second)
+
+	err = pull(options.PullPolicyMissing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStoredDigest(t, provider, ref, first)
+
+	err = pull(options.PullPolicyAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStoredDigest(t, provider, ref, second)
+
+	if count := registry.count(testLayerPath(t, ref, second)); count != 1 {
+		t.Errorf("layer of the new image downloaded %d times, want once", count)
+	}
+}
+
+// testLayerImage returns an image made of a single layer, different for each index.
+func testLayerImage(t *testing.T, index int) v1.Image {
+	t.Helper()
+
+	content := testLayer(t, []string{fmt.Sprintf("file-%d", index)}).Bytes()
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := mutate.AppendLayers(testImage(t, index), layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+// testLayerPath returns the registry path of the only layer of input image.
+func testLayerPath(t *testing.T, ref name.Reference, img v1.Image) string {
+	t.Helper()
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "/v2/" + ref.Context().RepositoryStr() + "/blobs/" + digest.String()
+}
+
+// testStoredDigest checks that input reference is stored as input image.
+func testStoredDigest(t *testing.T, provider *DockerlessProvider, ref name.Reference, img v1.Image) {
+	t.Helper()
+
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, found := provider.localImage(provider.ImageDir(ref.Name()), &v1.Platform{OS: "linux", Architecture: runtime.GOARCH})
+	if !found || got != want {
+		t.Errorf("stored image %s = %s, want %s", ref.Name(), got, want)
+	}
+}
@@ -0,0 +1,388 @@
+package dockerless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/driver"
+	"golang.org/x/sys/unix"
+)
+
+// Rebase will move the workspace with input id to input image, or to the image it was
+// created from if empty. The image is pulled again if its tag moved, unless PULL_POLICY
+// is never. The workspace's changes against its original image are kept, stopping it
+// first. Changed paths the new image changed as well are reported, and only overwritten
+// with the workspace's version if force is set.
+func (p *DockerlessProvider) Rebase(ctx context.Context, workspaceId, image string, force bool) error {
+	err := checkWorkspaceId(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	statusDIR := filepath.Join(p.Config.TargetDir, "status", workspaceId)
+	containerDIR := filepath.Join(p.Config.TargetDir, "rootfs", workspaceId)
+	configPath := filepath.Join(statusDIR, "runOptions")
+
+	runOptionsBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("container %s does not exist", workspaceId)
+		}
+
+		return err
+	}
+
+	runOptions := &driver.RunOptions{}
+
+	err = json.Unmarshal(runOptionsBytes, runOptions)
+	if err != nil {
+		return err
+	}
+
+	oldManifest, oldDigest, err := p.workspaceManifest(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	if image == "" {
+		image = runOptions.Image
+	}
+
+	imageOptions := &driver.RunOptions{Image: image}
+
+	// with the missing policy, a tag that moved would never be pulled again
+	puller := p
+	if p.Config.PullPolicy != options.PullPolicyNever {
+		pullOptions := *p.Config
+		pullOptions.PullPolicy = options.PullPolicyAlways
+		puller = &DockerlessProvider{Config: &pullOptions, Log: p.Log}
+	}
+
+	err = puller.Pull(ctx, imageOptions)
+	if err != nil {
+		return err
+	}
+
+	err = p.checkImagePolicy(imageOptions.Image)
+	if err != nil {
+		return err
+	}
+
+	imageDir := p.ImageDir(imageOptions.Image)
+
+	digest, err := imageDigest(imageDir)
+	if err != nil {
+		return err
+	}
+
+	if digest == oldDigest {
+		p.Log.Infof("%s is already based on %s", workspaceId, digest.String())
+
+		return nil
+	}
+
+	manifest, err := readImageManifest(imageDir)
+	if err != nil {
+		return err
+	}
+
+	layers, err := p.manifestLayers(manifest)
+	if err != nil {
+		return err
+	}
+
+	_, err = GetPid(workspaceId)
+	if err == nil {
+		err = p.Stop(ctx, workspaceId)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.Log.Infof("rebasing %s onto %s", workspaceId, digest.String())
+
+	oldLayers, overlay := p.workspaceLayers(workspaceId)
+
+	var oldLower, newLower []string
+
+	// the overlayfs upper directory already holds the workspace's changes, others
+	// are exported aside, against the extracted original image, and applied to a
+	// new rootfs that replaces the current one only once complete
+	rebaseDir := filepath.Join(p.Config.TargetDir, "rebase", workspaceId)
+	changesDir := filepath.Join(rebaseDir, "changes")
+	newRootfs := filepath.Join(rebaseDir, "rootfs")
+
+	if overlay {
+		if !p.overlaySupported(workspaceId, manifest) {
+			return fmt.Errorf("image %s cannot be mounted as overlayfs", imageOptions.Image)
+		}
+
+		err = p.extractLayers(workspaceId, manifest)
+		if err != nil {
+			return err
+		}
+
+		changesDir = filepath.Join(p.OverlayDir(workspaceId), "upper")
+		oldLower = p.layerDirs(oldLayers)
+		newLower = p.layerDirs(manifestDigests(manifest))
+	} else {
+		oldLayerFiles, err := p.manifestLayers(oldManifest)
+		if err != nil {
+			return err
+		}
+
+		err = p.prepareBase(workspaceId, oldDigest, oldLayerFiles)
+		if err != nil {
+			return err
+		}
+
+		oldLower = []string{p.baseDir(oldDigest)}
+		newLower = []string{p.baseDir(digest)}
+
+		// left by a previous rebase that failed, the rootfs was kept
+		err = NamespacedCommand(workspaceId, "rm", "-rf", rebaseDir).Run()
+		if err != nil {
+			return fmt.Errorf("removing previous rebase: %w", err)
+		}
+
+		err = os.MkdirAll(newRootfs, os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		defer func() { _ = NamespacedCommand(workspaceId, "rm", "-rf", rebaseDir).Run() }()
+
+		err = p.changesInNamespace(workspaceId, "export-changes", oldLower[0], containerDIR, changesDir)
+		if err != nil {
+			return err
+		}
+
+		// only unpacked once the changes are known to fit in a layer
+		err = p.prepareBase(workspaceId, digest, layers)
+		if err != nil {
+			return err
+		}
+	}
+
+	conflicts, err := p.rebaseConflicts(workspaceId, changesDir, !overlay, oldLower, newLower)
+	if err != nil {
+		return err
+	}
+
+	for _, conflict := range conflicts {
+		p.Log.Warnf("conflict: %s was changed by both the workspace and the image", conflict)
+	}
+
+	if len(conflicts) > 0 && !force {
+		return fmt.Errorf("%d conflicting paths, use --force to keep the workspace's version", len(conflicts))
+	}
+
+	if overlay {
+		// the work directory of the overlayfs must be empty when mounted on new lower directories
+		err = NamespacedCommand(workspaceId, "rm", "-rf", filepath.Join(p.OverlayDir(workspaceId), "work")).Run()
+		if err != nil {
+			return fmt.Errorf("removing overlayfs work directory: %w", err)
+		}
+
+		err = os.MkdirAll(filepath.Join(p.OverlayDir(workspaceId), "work"), 0o755)
+		if err != nil {
+			return err
+		}
+
+		err = p.saveWorkspaceLayers(workspaceId, manifestDigests(manifest))
+		if err != nil {
+			return err
+		}
+	} else {
+		err = p.cloneInNamespace(workspaceId, digest, newRootfs)
+		if err != nil {
+			return err
+		}
+
+		err = p.changesInNamespace(workspaceId, "apply-changes", changesDir, newRootfs)
+		if err != nil {
+			return err
+		}
+
+		err = swapDirs(containerDIR, newRootfs)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.rebaseStatus(workspaceId, runOptions, imageOptions.Image, digest)
+	if err != nil {
+		return err
+	}
+
+	p.Log.Info("done")
+
+	return nil
+}
+
+// swapDirs will exchange the directories at input paths, atomically if the
+// filesystem supports it.
+func swapDirs(path, other string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, path, unix.AT_FDCWD, other, unix.RENAME_EXCHANGE)
+	if !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOSYS) {
+		return err
+	}
+
+	temp := other + ".swap"
+
+	err = os.Rename(path, temp)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(other, path)
+	if err != nil {
+		_ = os.Rename(temp, path)
+
+		return err
+	}
+
+	return os.Rename(temp, other)
+}
+
+// rebaseStatus will point the status of the workspace with input id to the image with
+// input name and digest, updating the run options that came from the previous image.
+func (p *DockerlessProvider) rebaseStatus(workspaceId string, runOptions *driver.RunOptions, image string, digest v1.Hash) error {
+	statusDIR := filepath.Join(p.Config.TargetDir, "status", workspaceId)
+	imageDir := p.ImageDir(image)
+
+	oldConfig := p.workspaceConfig(workspaceId)
+
+	imageConfig, err := readImageConfig(imageDir)
+	if err != nil {
+		return err
+	}
+
+	rebaseRunOptions(runOptions, oldConfig, &imageConfig.Config)
+	runOptions.Image = image
+
+	configFile, err := os.ReadFile(filepath.Join(imageDir, "config.json"))
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(statusDIR, "config.json"), configFile, 0o644)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(statusDIR, "imageDigest"), []byte(digest.String()), 0o644)
+	if err != nil {
+		return err
+	}
+
+	file, err := json.MarshalIndent(runOptions, "", " ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(statusDIR, "runOptions"), file, 0o644)
+}
+
+// rebaseRunOptions will replace the environment, command and user the run options
+// got from the old image config by the ones of the new image config. The ones
+// set by the run options themselves are kept.
+func rebaseRunOptions(runOptions *driver.RunOptions, oldConfig, newConfig *v1.Config) {
+	if runOptions.Env == nil {
+		runOptions.Env = map[string]string{}
+	}
+
+	for key, value := range config.ListToObject(oldConfig.Env) {
+		if runOptions.Env[key] == value {
+			delete(runOptions.Env, key)
+		}
+	}
+
+	for key, value := range config.ListToObject(newConfig.Env) {
+		if runOptions.Env[key] == "" {
+			runOptions.Env[key] = value
+		}
+	}
+
+	oldCommand, _ := containerCommand(&driver.RunOptions{}, oldConfig)
+	command := append([]string{runOptions.Entrypoint}, runOptions.Cmd...)
+
+	newCommand, err := containerCommand(&driver.RunOptions{}, newConfig)
+	if err == nil && strings.Join(command, "\x00") == strings.Join(oldCommand, "\x00") {
+		runOptions.Entrypoint = newCommand[0]
+		runOptions.Cmd = newCommand[1:]
+	}
+
+	if runOptions.User == oldConfig.User {
+		runOptions.User = newConfig.User
+	}
+}
+
+// rebaseConflicts returns the paths of changesDir, exported by ExportChanges if exported
+// is set, that differ between the lower directories oldLower and newLower, using the
+// hidden "conflicts" command in a new user namespace for the container with input id.
+func (p *DockerlessProvider) rebaseConflicts(workspaceId, changesDir string, exported bool, oldLower, newLower []string) ([]string, error) {
+	args := []string{os.Args[0], "conflicts", changesDir}
+	if exported {
+		args = append(args, "--exported")
+	}
+	for _, dir := range oldLower {
+		args = append(args, "--old", dir)
+	}
+
+	for _, dir := range newLower {
+		args = append(args, "--new", dir)
+	}
+
+	cmd := NamespacedCommand(workspaceId, args...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("finding conflicts: %w", err)
+	}
+
+	conflicts := []string{}
+
+	err = json.Unmarshal(out, &conflicts)
+	if err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+// changesInNamespace will run the hidden changes command with input name and args
+// in a new user namespace for the container with input id.
+func (p *DockerlessProvider) changesInNamespace(workspaceId, command string, args ...string) error {
+	cmd := NamespacedCommand(workspaceId, append([]string{os.Args[0], command}, args...)...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s: %w", command, err)
+	}
+
+	return nil
+}
+
+// manifestDigests returns the digests of the layers of input manifest.
+func manifestDigests(manifest *v1.Manifest) []v1.Hash {
+	digests := []v1.Hash{}
+	for _, layer := range manifest.Layers {
+		digests = append(digests, layer.Digest)
+	}
+
+	return digests
+}
@@ -0,0 +1,81 @@
+package dockerless
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/loft-sh/devpod/pkg/driver"
+)
+
+func TestRebaseRunOptions(t *testing.T) {
+	oldConfig := &v1.Config{
+		Env:        []string{"PATH=/old/bin", "LANG=C", "OLD_ONLY=1"},
+		Entrypoint: []string{"/old-entrypoint.sh"},
+		Cmd:        []string{"serve"},
+		User:       "dev",
+	}
+
+	newConfig := &v1.Config{
+		Env:        []string{"PATH=/new/bin", "LANG=C.UTF-8", "NEW_ONLY=1"},
+		Entrypoint: []string{"/new-entrypoint.sh"},
+		Cmd:        []string{"run"},
+		User:       "app",
+	}
+
+	tests := []struct {
+		name       string
+		runOptions driver.RunOptions
+		want       driver.RunOptions
+	}{
+		{
+			name: "inherited from the old image",
+			runOptions: driver.RunOptions{
+				Env:        map[string]string{"PATH": "/old/bin", "LANG": "C", "OLD_ONLY": "1"},
+				Entrypoint: "/old-entrypoint.sh",
+				Cmd:        []string{"serve"},
+				User:       "dev",
+			},
+			want: driver.RunOptions{
+				Env:        map[string]string{"PATH": "/new/bin", "LANG": "C.UTF-8", "NEW_ONLY": "1"},
+				Entrypoint: "/new-entrypoint.sh",
+				Cmd:        []string{"run"},
+				User:       "app",
+			},
+		},
+		{
+			name: "overridden by the user",
+			runOptions: driver.RunOptions{
+				Env:        map[string]string{"PATH": "/custom/bin", "LANG": "C", "EDITOR": "vim"},
+				Entrypoint: "sleep",
+				Cmd:        []string{"infinity"},
+				User:       "root",
+			},
+			want: driver.RunOptions{
+				Env:        map[string]string{"PATH": "/custom/bin", "LANG": "C.UTF-8", "EDITOR": "vim", "NEW_ONLY": "1"},
+				Entrypoint: "sleep",
+				Cmd:        []string{"infinity"},
+				User:       "root",
+			},
+		},
+		{
+			name:       "no environment",
+			runOptions: driver.RunOptions{Entrypoint: "/old-entrypoint.sh", Cmd: []string{"serve"}},
+			want: driver.RunOptions{
+				Env:        map[string]string{"PATH": "/new/bin", "LANG": "C.UTF-8", "NEW_ONLY": "1"},
+				Entrypoint: "/new-entrypoint.sh",
+				Cmd:        []string{"run"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		runOptions := test.runOptions
+
+		rebaseRunOptions(&runOptions, oldConfig, newConfig)
+
+		if !reflect.DeepEqual(runOptions, test.want) {
+			t.Errorf("%s: rebaseRunOptions() = %+v, want %+v", test.name, runOptions, test.want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package dockerless
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// RegistriesConfig is the subset of containers' registries.conf (version 2) in use.
+// See https://github.com/containers/image/blob/main/docs/containers-registries.conf.5.md
+type RegistriesConfig struct {
+	UnqualifiedSearchRegistries []string         `toml:"unqualified-search-registries"`
+	Registries                  []RegistryConfig `toml:"registry"`
+}
+
+// RegistryConfig is a [[registry]] table of registries.conf.
+type RegistryConfig struct {
+	Prefix             string         `toml:"prefix"`
+	Location           string         `toml:"location"`
+	Insecure           bool           `toml:"insecure"`
+	Blocked            bool           `toml:"blocked"`
+	MirrorByDigestOnly bool           `toml:"mirror-by-digest-only"`
+	Mirrors            []MirrorConfig `toml:"mirror"`
+}
+
+// MirrorConfig is a [[registry.mirror]] table of registries.conf.
+type MirrorConfig struct {
+	Location       string `toml:"location"`
+	Insecure       bool   `toml:"insecure"`
+	PullFromMirror string `toml:"pull-from-mirror"`
+}
+
+// pullSource is a location an image can be pulled from.
+type pullSource struct {
+	ref       name.Reference
+	insecure  bool
+	transport http.RoundTripper
+}
+
+// RegistriesConfigFile returns the path of the registries.conf in use, empty if none exists.
+// Only TARGET_DIR/registries.conf is used: the host's one configures other tools, and
+// would change what unqualified images resolve to.
+func (p *DockerlessProvider) RegistriesConfigFile() string {
+	path := filepath.Join(p.Config.TargetDir, "registries.conf")
+	if !Exist(path) {
+		return ""
+	}
+
+	return path
+}
+
+// RegistriesConfig returns the parsed registries.conf, empty if none exists.
+func (p *DockerlessProvider) RegistriesConfig() (*RegistriesConfig, error) {
+	registriesConfig := &RegistriesConfig{}
+
+	path := p.RegistriesConfigFile()
+	if path == "" {
+		return registriesConfig, nil
+	}
+
+	_, err := toml.DecodeFile(path, registriesConfig)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+
+	for _, registry := range registriesConfig.Registries {
+		if registry.Prefix == "" && registry.Location == "" {
+			return nil, fmt.Errorf("loading %s: registry entries need a prefix or a location", path)
+		}
+
+		if strings.HasPrefix(registry.Prefix, "*.") && registry.Location != "" {
+			return nil, fmt.Errorf("loading %s: wildcard prefix %s cannot have a location", path, registry.Prefix)
+		}
+	}
+
+	return registriesConfig, nil
+}
+
+// ResolveImage returns the fully qualified references input image may refer to.
+// Unqualified images, like alpine, are looked up in each of the unqualified-search-registries,
+// in order, falling back to docker hub if none is configured.
+func (p *DockerlessProvider) ResolveImage(image string) ([]name.Reference, error) {
+	registriesConfig, err := p.RegistriesConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if !isUnqualified(image) || len(registriesConfig.UnqualifiedSearchRegistries) == 0 {
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			return nil, err
+		}
+
+		return []name.Reference{ref}, nil
+	}
+
+	refs := []name.Reference{}
+
+	for _, registry := range registriesConfig.UnqualifiedSearchRegistries {
+		ref, err := name.ParseReference(registry + "/" + image)
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+// pullSources returns where input reference should be pulled from, in order:
+// the mirrors of the matching registry entry, then its location.
+func (c *RegistriesConfig) pullSources(ref name.Reference) ([]pullSource, error) {
+	registry, prefix := c.findRegistry(ref)
+	if registry == nil {
+		return []pullSource{{ref: ref}}, nil
+	}
+
+	if registry.Blocked {
+		return nil, fmt.Errorf("pulling %s is blocked by registries.conf", ref.Name())
+	}
+
+	location := registry.Location
+	if location == "" {
+		location = prefix
+	}
+
+	// wildcard entries apply to the registry as is
+	if strings.HasPrefix(prefix, "*.") {
+		prefix = normalizeRegistry(ref.Context().RegistryStr())
+		location = prefix
+	}
+
+	_, byDigest := ref.(name.Digest)
+	sources := []pullSource{}
+
+	for _, mirror := range registry.Mirrors {
+		pullFromMirror := mirror.PullFromMirror
+		if registry.MirrorByDigestOnly {
+			pullFromMirror = "digest-only"
+		}
+
+		if (pullFromMirror == "digest-only" && !byDigest) || (pullFromMirror == "tag-only" && byDigest) {
+			continue
+		}
+
+		mirrorRef, err := rewriteReference(ref, prefix, mirror.Location, mirror.Insecure)
+		if err != nil {
+			return nil, fmt.Errorf("mirror %s: %w", mirror.Location, err)
+		}
+
+		sources = append(sources, pullSource{ref: mirrorRef, insecure: mirror.Insecure})
+	}
+
+	locationRef, err := rewriteReference(ref, prefix, location, registry.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("registry %s: %w", location, err)
+	}
+
+	sources = append(sources, pullSource{ref: locationRef, insecure: registry.Insecure})
+
+	return sources, nil
+}
+
+// findRegistry returns the registry entry matching input reference, and its prefix.
+// As in containers, the longest matching prefix wins.
+func (c *RegistriesConfig) findRegistry(ref name.Reference) (*RegistryConfig, string) {
+	key := referenceKey(ref)
+	host := strings.SplitN(key, "/", 2)[0]
+
+	var found *RegistryConfig
+
+	foundPrefix := ""
+
+	for index := range c.Registries {
+		registry := &c.Registries[index]
+
+		prefix := registry.Prefix
+		if prefix == "" {
+			prefix = registry.Location
+		}
+
+		prefix = normalizeRegistry(strings.TrimSuffix(prefix, "/"))
+
+		matches := false
+		if strings.HasPrefix(prefix, "*.") {
+			matches = strings.HasSuffix(host, prefix[1:])
+		} else {
+			matches = key == prefix || strings.HasPrefix(key, prefix+"/")
+		}
+
+		if matches && len(prefix) > len(foundPrefix) {
+			found = registry
+			foundPrefix = prefix
+		}
+	}
+
+	return found, foundPrefix
+}
+
+// registryTransport returns the transport used to reach input registry, trusting
+// the CA bundles configured for it and skipping verification if insecure.
+// CA bundles (*.crt) and client certificates (*.cert with their *.key) are looked up in
+// TARGET_DIR/certs.d/<registry>, /etc/containers/certs.d/<registry> and /etc/docker/certs.d/<registry>.
+func (p *DockerlessProvider) registryTransport(registry name.Registry, insecure bool) (http.RoundTripper, error) {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:            rootCAs,
+		InsecureSkipVerify: insecure, //nolint:gosec // requested in registries.conf
+	}
+
+	found := false
+
+	for _, certsDIR := range []string{
+		filepath.Join(p.Config.TargetDir, "certs.d"),
+		"/etc/containers/certs.d",
+		"/etc/docker/certs.d",
+	} {
+		// docker hub's directory may be named either index.docker.io or docker.io
+		for _, registryName := range []string{registry.RegistryStr(), normalizeRegistry(registry.RegistryStr())} {
+			loaded, err := loadCertsDir(filepath.Join(certsDIR, registryName), tlsConfig)
+			if err != nil {
+				return nil, err
+			}
+
+			found = found || loaded
+		}
+	}
+
+	if !found && !insecure {
+		return remote.DefaultTransport, nil
+	}
+
+	roundTripper := remote.DefaultTransport.(*http.Transport).Clone()
+	roundTripper.TLSClientConfig = tlsConfig
+
+	return roundTripper, nil
+}
+
+// loadCertsDir will add the certificates found in a certs.d directory to input tls config.
+// Returns whether any was found.
+func loadCertsDir(dir string, tlsConfig *tls.Config) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	found := false
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		switch filepath.Ext(entry.Name()) {
+		case ".crt":
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return false, err
+			}
+
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+				return false, fmt.Errorf("no valid certificate found in %s", path)
+			}
+
+			found = true
+		case ".cert":
+			keyPath := strings.TrimSuffix(path, ".cert") + ".key"
+
+			certificate, err := tls.LoadX509KeyPair(path, keyPath)
+			if err != nil {
+				return false, fmt.Errorf("loading client certificate %s: %w", path, err)
+			}
+
+			tlsConfig.Certificates = append(tlsConfig.Certificates, certificate)
+			found = true
+		}
+	}
+
+	return found, nil
+}
+
+// rewriteReference replaces the prefix of input reference with location,
+// keeping its tag or digest.
+func rewriteReference(ref name.Reference, prefix, location string, insecure bool) (name.Reference, error) {
+	repository := strings.TrimSuffix(location, "/") + strings.TrimPrefix(referenceKey(ref), prefix)
+
+	separator := ":"
+	if _, ok := ref.(name.Digest); ok {
+		separator = "@"
+	}
+
+	options := []name.Option{}
+	if insecure {
+		options = append(options, name.Insecure)
+	}
+
+	return name.ParseReference(repository+separator+ref.Identifier(), options...)
+}
+
+// referenceKey returns the repository of input reference, as written in
+// registries.conf, eg docker.io/library/alpine.
+func referenceKey(ref name.Reference) string {
+	return normalizeRegistry(ref.Context().RegistryStr()) + "/" + ref.Context().RepositoryStr()
+}
+
+// normalizeRegistry replaces docker hub's canonical registry name with the one used in registries.conf.
+func normalizeRegistry(registry string) string {
+	if registry == name.DefaultRegistry || strings.HasPrefix(registry, name.DefaultRegistry+"/") {
+		return "docker.io" + strings.TrimPrefix(registry, name.DefaultRegistry)
+	}
+
+	return registry
+}
+
+// isUnqualified returns whether input image does not name its registry, eg alpine or library/alpine.
+func isUnqualified(image string) bool {
+	domain, _, ok := strings.Cut(image, "/")
+	if !ok {
+		return true
+	}
+
+	return !strings.ContainsAny(domain, ".:") && domain != "localhost"
+}
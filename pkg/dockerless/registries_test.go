@@ -0,0 +1,276 @@
+package dockerless
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+)
+
+func TestFindRegistry(t *testing.T) {
+	config := &RegistriesConfig{
+		Registries: []RegistryConfig{
+			{Prefix: "docker.io", Location: "mirror.example.com/hub"},
+			{Prefix: "docker.io/library/alpine", Location: "alpine.example.com/alpine"},
+			{Location: "registry.example.com/team"},
+			{Prefix: "*.internal.example.com", Insecure: true},
+			{Prefix: "*.example.com", Blocked: true},
+		},
+	}
+
+	tests := []struct {
+		image      string
+		wantPrefix string
+	}{
+		{image: "alpine", wantPrefix: "docker.io/library/alpine"},
+		{image: "alpine-extra", wantPrefix: "docker.io"},
+		{image: "docker.io/library/alpine/sub", wantPrefix: "docker.io/library/alpine"},
+		{image: "busybox", wantPrefix: "docker.io"},
+		{image: "registry.example.com/team/app", wantPrefix: "registry.example.com/team"},
+		{image: "registry.example.com/teams/app", wantPrefix: "*.example.com"},
+		{image: "cache.internal.example.com/app", wantPrefix: "*.internal.example.com"},
+		{image: "quay.io/team/app"},
+	}
+
+	for _, test := range tests {
+		ref, err := name.ParseReference(test.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		registry, prefix := config.findRegistry(ref)
+		if prefix != test.wantPrefix {
+			t.Errorf("findRegistry(%s) prefix = %q, want %q", test.image, prefix, test.wantPrefix)
+		}
+
+		if (registry == nil) != (test.wantPrefix == "") {
+			t.Errorf("findRegistry(%s) = %+v, want an entry for %q", test.image, registry, test.wantPrefix)
+		}
+	}
+}
+
+func TestPullSources(t *testing.T) {
+	digest := "sha256:" + testHash(t, "a", 0).Hex
+
+	config := &RegistriesConfig{
+		Registries: []RegistryConfig{
+			{
+				Prefix: "docker.io",
+				Mirrors: []MirrorConfig{
+					{Location: "mirror.example.com"},
+					{Location: "digests.example.com/hub", PullFromMirror: "digest-only"},
+					{Location: "tags.example.com", PullFromMirror: "tag-only", Insecure: true},
+				},
+			},
+			{
+				Prefix:             "registry.example.com/team",
+				Location:           "other.example.com/team",
+				MirrorByDigestOnly: true,
+				Mirrors:            []MirrorConfig{{Location: "mirror.example.com/team", PullFromMirror: "tag-only"}},
+			},
+			{Prefix: "blocked.example.com", Blocked: true},
+			{Prefix: "*.wildcard.com", Mirrors: []MirrorConfig{{Location: "mirror.example.com"}}},
+		},
+	}
+
+	tests := []struct {
+		image   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			image: "alpine:3.19",
+			want:  []string{"mirror.example.com/library/alpine:3.19", "tags.example.com/library/alpine:3.19", "index.docker.io/library/alpine:3.19"},
+		},
+		{
+			image: "alpine@" + digest,
+			want: []string{
+				"mirror.example.com/library/alpine@" + digest,
+				"digests.example.com/hub/library/alpine@" + digest,
+				"index.docker.io/library/alpine@" + digest,
+			},
+		},
+		{
+			// mirror-by-digest-only applies to all the mirrors of the entry
+			image: "registry.example.com/team/app:v1",
+			want:  []string{"other.example.com/team/app:v1"},
+		},
+		{
+			image: "registry.example.com/team/app@" + digest,
+			want:  []string{"mirror.example.com/team/app@" + digest, "other.example.com/team/app@" + digest},
+		},
+		{
+			image: "registry.wildcard.com/app:v1",
+			want:  []string{"mirror.example.com/app:v1", "registry.wildcard.com/app:v1"},
+		},
+		{image: "quay.io/app:v1", want: []string{"quay.io/app:v1"}},
+		{image: "blocked.example.com/app", wantErr: true},
+	}
+
+	for _, test := range tests {
+		ref, err := name.ParseReference(test.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sources, err := config.pullSources(ref)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("pullSources(%s) = %v, want an error", test.image, sources)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("pullSources(%s) error = %v", test.image, err)
+
+			continue
+		}
+
+		got := []string{}
+		for _, source := range sources {
+			got = append(got, source.ref.Name())
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("pullSources(%s) = %v, want %v", test.image, got, test.want)
+		}
+	}
+}
+
+func TestRewriteReference(t *testing.T) {
+	digest := "sha256:" + testHash(t, "a", 0).Hex
+
+	tests := []struct {
+		image    string
+		prefix   string
+		location string
+		insecure bool
+		want     string
+	}{
+		{image: "alpine", prefix: "docker.io", location: "mirror.example.com", want: "mirror.example.com/library/alpine:latest"},
+		{image: "alpine@" + digest, prefix: "docker.io/library", location: "mirror.example.com/hub/", want: "mirror.example.com/hub/alpine@" + digest},
+		{image: "registry.example.com/team/app:v1", prefix: "registry.example.com/team", location: "localhost:5000", want: "localhost:5000/app:v1"},
+		{image: "registry.example.com/app:v1", prefix: "registry.example.com", location: "10.0.0.1:5000", insecure: true, want: "10.0.0.1:5000/app:v1"},
+	}
+
+	for _, test := range tests {
+		ref, err := name.ParseReference(test.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := rewriteReference(ref, test.prefix, test.location, test.insecure)
+		if err != nil {
+			t.Errorf("rewriteReference(%s) error = %v", test.image, err)
+
+			continue
+		}
+
+		if got.Name() != test.want {
+			t.Errorf("rewriteReference(%s, %s, %s) = %s, want %s", test.image, test.prefix, test.location, got.Name(), test.want)
+		}
+
+		if test.insecure && got.Context().Scheme() != "http" {
+			t.Errorf("rewriteReference(%s) of an insecure location uses %s", test.image, got.Context().Scheme())
+		}
+	}
+}
+
+func TestResolveImage(t *testing.T) {
+	tests := []struct {
+		config string
+		image  string
+		want   []string
+	}{
+		{image: "alpine", want: []string{"index.docker.io/library/alpine:latest"}},
+		{
+			config: `unqualified-search-registries = ["quay.io", "docker.io"]`,
+			image:  "alpine:3.19",
+			want:   []string{"quay.io/alpine:3.19", "index.docker.io/library/alpine:3.19"},
+		},
+		{
+			config: `unqualified-search-registries = ["quay.io", "docker.io"]`,
+			image:  "team/app",
+			want:   []string{"quay.io/team/app:latest", "index.docker.io/team/app:latest"},
+		},
+		{
+			config: `unqualified-search-registries = ["quay.io"]`,
+			image:  "registry.example.com/app",
+			want:   []string{"registry.example.com/app:latest"},
+		},
+		{
+			config: `unqualified-search-registries = ["quay.io"]`,
+			image:  "localhost/app",
+			want:   []string{"index.docker.io/localhost/app:latest"},
+		},
+	}
+
+	for _, test := range tests {
+		provider := &DockerlessProvider{
+			Config: &options.Options{TargetDir: t.TempDir()},
+			Log:    log.Discard,
+		}
+
+		if test.config != "" {
+			err := os.WriteFile(filepath.Join(provider.Config.TargetDir, "registries.conf"), []byte(test.config), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		refs, err := provider.ResolveImage(test.image)
+		if err != nil {
+			t.Errorf("ResolveImage(%s) error = %v", test.image, err)
+
+			continue
+		}
+
+		got := []string{}
+		for _, ref := range refs {
+			got = append(got, ref.Name())
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ResolveImage(%s) with %q = %v, want %v", test.image, test.config, got, test.want)
+		}
+	}
+}
+
+func TestRegistriesConfigFile(t *testing.T) {
+	hostConfig := filepath.Join(t.TempDir(), "registries.conf")
+
+	err := os.WriteFile(hostConfig, []byte(`unqualified-search-registries = ["quay.io"]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the configuration of other tools is not used
+	t.Setenv("CONTAINERS_REGISTRIES_CONF", hostConfig)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Dir(hostConfig))
+
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir()},
+		Log:    log.Discard,
+	}
+
+	if path := provider.RegistriesConfigFile(); path != "" {
+		t.Errorf("RegistriesConfigFile() = %s, want none", path)
+	}
+
+	path := filepath.Join(provider.Config.TargetDir, "registries.conf")
+
+	err = os.WriteFile(path, []byte(`unqualified-search-registries = ["docker.io"]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := provider.RegistriesConfigFile(); got != path {
+		t.Errorf("RegistriesConfigFile() = %s, want %s", got, path)
+	}
+}
@@ -0,0 +1,205 @@
+package dockerless
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// workspaceManifest returns the manifest, and its digest, of the image the workspace
+// with input id was created from. It is read from the store, as the image's tag
+// might have moved since.
+func (p *DockerlessProvider) workspaceManifest(workspaceId string) (*v1.Manifest, v1.Hash, error) {
+	digestBytes, err := os.ReadFile(filepath.Join(p.Config.TargetDir, "status", workspaceId, "imageDigest"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, v1.Hash{}, fmt.Errorf("container %s does not exist", workspaceId)
+		}
+
+		return nil, v1.Hash{}, err
+	}
+
+	digest, err := v1.NewHash(strings.TrimSpace(string(digestBytes)))
+	if err != nil {
+		return nil, v1.Hash{}, err
+	}
+
+	manifestBytes, err := os.ReadFile(p.BlobPath(digest))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, v1.Hash{}, fmt.Errorf("image %s of %s is no longer stored", digest.String(), workspaceId)
+		}
+
+		return nil, v1.Hash{}, err
+	}
+
+	manifest := &v1.Manifest{}
+
+	err = json.Unmarshal(manifestBytes, manifest)
+	if err != nil {
+		return nil, v1.Hash{}, err
+	}
+
+	return manifest, digest, nil
+}
+
+// Reset will rebuild the rootfs of the workspace with input id from the image it
+// was created from, stopping it first. Run options, mounts and volumes are kept.
+func (p *DockerlessProvider) Reset(ctx context.Context, workspaceId string) error {
+	err := checkWorkspaceId(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	statusDIR := filepath.Join(p.Config.TargetDir, "status", workspaceId)
+
+	if !Exist(filepath.Join(statusDIR, "runOptions")) {
+		return fmt.Errorf("container %s does not exist", workspaceId)
+	}
+
+	manifest, digest, err := p.workspaceManifest(workspaceId)
+	if err != nil {
+		return err
+	}
+
+	// nothing is touched when the image cannot be extracted again
+	if !p.hasLayers(manifest) {
+		return fmt.Errorf("layers of image %s of %s are no longer stored", digest.String(), workspaceId)
+	}
+
+	_, err = GetPid(workspaceId)
+	if err == nil {
+		err = p.Stop(ctx, workspaceId)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.Log.Infof("resetting: %s", workspaceId)
+
+	scratchDir, cleanup, err := p.scratchDir(workspaceId, "reset")
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	// the new rootfs is prepared aside, the current one is kept if that fails
+	newRootfs := filepath.Join(scratchDir, "rootfs")
+	newOverlay := filepath.Join(scratchDir, "overlay")
+
+	err = os.MkdirAll(newRootfs, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	layers, err := p.manifestLayers(manifest)
+	if err != nil {
+		return err
+	}
+
+	overlay := p.overlaySupported(workspaceId, manifest)
+	if overlay {
+		err = p.extractLayers(workspaceId, manifest)
+		if err != nil {
+			return err
+		}
+
+		for _, dir := range []string{"upper", "work"} {
+			err = os.MkdirAll(filepath.Join(newOverlay, dir), 0o755)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		err = p.prepareBase(workspaceId, digest, layers)
+		if err != nil {
+			return err
+		}
+
+		err = p.cloneInNamespace(workspaceId, digest, newRootfs)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.replaceRootfs(workspaceId, newRootfs, newOverlay)
+	if err != nil {
+		return err
+	}
+
+	if overlay {
+		err = p.saveWorkspaceLayers(workspaceId, manifestDigests(manifest))
+	} else {
+		err = os.Remove(filepath.Join(statusDIR, "layers"))
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	p.Log.Info("done")
+
+	return nil
+}
+
+// scratchDir returns an empty directory to prepare a new rootfs of the workspace with
+// input id in, aside from its current one, for input operation, eg TARGET_DIR/reset/<id>.
+// The returned function removes it.
+func (p *DockerlessProvider) scratchDir(workspaceId, operation string) (string, func(), error) {
+	dir := filepath.Join(p.Config.TargetDir, operation, workspaceId)
+
+	// left by a previous run that failed, files belong to the container's users
+	err := NamespacedCommand(workspaceId, "rm", "-rf", dir).Run()
+	if err != nil {
+		return "", nil, fmt.Errorf("removing %s: %w", dir, err)
+	}
+
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return dir, func() { _ = NamespacedCommand(workspaceId, "rm", "-rf", dir).Run() }, nil
+}
+
+// replaceRootfs will replace the rootfs and the overlayfs directories of the workspace with
+// input id with input ones, which then hold the previous ones. A missing replacement removes
+// the directory, the previous one being moved to the replacement's path.
+func (p *DockerlessProvider) replaceRootfs(workspaceId, rootfs, overlay string) error {
+	targets := [][2]string{
+		{filepath.Join(p.Config.TargetDir, "rootfs", workspaceId), rootfs},
+		{p.OverlayDir(workspaceId), overlay},
+	}
+
+	for _, target := range targets {
+		if !Exist(target[1]) {
+			err := os.Rename(target[0], target[1])
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			continue
+		}
+
+		err := os.MkdirAll(target[0], os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		err = swapDirs(target[0], target[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
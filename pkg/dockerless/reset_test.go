@@ -0,0 +1,62 @@
+package dockerless
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+)
+
+func TestResetMissingLayers(t *testing.T) {
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir()},
+		Log:    log.Discard,
+	}
+
+	manifest := &v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+		Config:        v1.Descriptor{MediaType: types.OCIConfigJSON, Digest: testHash(t, "c", 0)},
+		Layers:        []v1.Descriptor{{MediaType: types.OCILayer, Digest: testHash(t, "a", 0)}},
+	}
+
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := testHash(t, "b", 0)
+	statusDIR := filepath.Join(provider.Config.TargetDir, "status", "workspace")
+	userFile := filepath.Join(provider.Config.TargetDir, "rootfs", "workspace", "home", "file")
+
+	writeTestFile(t, provider.BlobPath(digest))
+	writeTestFile(t, filepath.Join(statusDIR, "runOptions"))
+	writeTestFile(t, userFile)
+
+	err = os.WriteFile(provider.BlobPath(digest), manifestBytes, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(statusDIR, "imageDigest"), []byte(digest.String()), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the layer blob was never downloaded, the rootfs cannot be rebuilt
+	err = provider.Reset(context.Background(), "workspace")
+	if err == nil || !strings.Contains(err.Error(), "no longer stored") {
+		t.Errorf("Reset() error = %v, want missing layers", err)
+	}
+
+	if !Exist(userFile) {
+		t.Errorf("Reset() removed the rootfs of the workspace")
+	}
+}
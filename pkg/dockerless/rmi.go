@@ -0,0 +1,59 @@
+package dockerless
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RemoveImage will remove the reference of the stored image with input name.
+// Images used by a workspace are only removed if force is set, their workspaces
+// keep working from their own rootfs. Blobs are left in the store, until
+// reclaimed by PruneImages.
+func (p *DockerlessProvider) RemoveImage(image string, force bool) error {
+	image = p.storedName(image)
+
+	// index.json is updated, and workspaces being created must not lose their image
+	unlock, err := p.LockStore(true)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if !Exist(p.ImageDir(image)) {
+		return fmt.Errorf("image %s not found", image)
+	}
+
+	used, err := p.WorkspaceImages()
+	if err != nil {
+		return err
+	}
+
+	workspaces := used[image]
+	if len(workspaces) > 0 && !force {
+		return fmt.Errorf(
+			"image %s is used by workspaces %s, use --force to remove it anyway",
+			image,
+			strings.Join(workspaces, ", "),
+		)
+	}
+
+	store, err := p.openStore()
+	if err != nil {
+		return err
+	}
+
+	err = untagImage(store, image)
+	if err != nil {
+		return err
+	}
+
+	err = p.removeImageDir(image)
+	if err != nil {
+		return err
+	}
+
+	p.Log.Infof("removed image %s", image)
+
+	return nil
+}
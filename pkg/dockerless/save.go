@@ -0,0 +1,119 @@
+package dockerless
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+const (
+	// SaveFormatDockerArchive saves images as a docker save tarball
+	SaveFormatDockerArchive = "docker-archive"
+	// SaveFormatOCI saves images in an OCI image layout directory
+	SaveFormatOCI = "oci"
+)
+
+// StoredImage returns the stored image with input name, backed by the store's blobs.
+func (p *DockerlessProvider) StoredImage(image string) (v1.Image, error) {
+	imageDir := p.ImageDir(image)
+
+	manifest, err := readImageManifest(imageDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("image %s not found", p.storedName(image))
+		}
+
+		return nil, err
+	}
+
+	if !p.hasLayers(manifest) {
+		return nil, fmt.Errorf("image %s is incomplete, pull it again", p.storedName(image))
+	}
+
+	digest, err := imageDigest(imageDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return layout.Path(p.StoreDir()).Image(digest)
+}
+
+// SaveImages will write input stored images to output, either as a docker save
+// tarball or in an OCI image layout directory, following format.
+// The OCI image layout keeps the manifests as they are, the docker save format only
+// keeps the configs and layers. Both can be imported back with the docker-archive:
+// and oci: transports.
+func (p *DockerlessProvider) SaveImages(ctx context.Context, images []string, format, output string) error {
+	refToImage := map[name.Reference]v1.Image{}
+
+	for _, image := range images {
+		ref, err := name.ParseReference(p.storedName(image))
+		if err != nil {
+			return err
+		}
+
+		img, err := p.StoredImage(image)
+		if err != nil {
+			return err
+		}
+
+		refToImage[ref] = img
+	}
+
+	switch format {
+	case SaveFormatDockerArchive:
+		p.Log.Infof("saving %d images to %s", len(refToImage), output)
+
+		err := tarball.MultiRefWriteToFile(output, refToImage)
+		if err != nil {
+			return err
+		}
+	case SaveFormatOCI:
+		p.Log.Infof("saving %d images to %s", len(refToImage), output)
+
+		err := saveOCILayout(output, refToImage)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %s, expected %s or %s", format, SaveFormatDockerArchive, SaveFormatOCI)
+	}
+
+	for ref := range refToImage {
+		p.Log.Infof("saved %s", ref.Name())
+	}
+
+	return nil
+}
+
+// saveOCILayout will write input images in the OCI image layout at path, creating it
+// if needed. Images are annotated with their name, replacing the ones already there.
+func saveOCILayout(path string, refToImage map[name.Reference]v1.Image) error {
+	output, err := layout.FromPath(path)
+	if err != nil {
+		output, err = layout.Write(path, empty.Index)
+		if err != nil {
+			return err
+		}
+	}
+
+	for ref, img := range refToImage {
+		err = output.ReplaceImage(
+			img,
+			match.Annotation(refNameAnnotation, ref.Name()),
+			layout.WithAnnotations(map[string]string{refNameAnnotation: ref.Name()}),
+		)
+		if err != nil {
+			return fmt.Errorf("saving %s: %w", ref.Name(), err)
+		}
+	}
+
+	return nil
+}
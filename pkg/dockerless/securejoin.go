@@ -0,0 +1,123 @@
+package dockerless
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinkDepth is the maximum number of symlinks followed while resolving a path,
+// same as the kernel's limit.
+const maxSymlinkDepth = 40
+
+// UnsafePathError is returned when a layer entry would be written outside
+// of the container root.
+type UnsafePathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("unsafe layer entry %q: %s", e.Path, e.Reason)
+}
+
+// cleanEntryName will validate a path found in a layer and return it
+// cleaned and rooted at "/".
+// Absolute paths and paths traversing above the root are rejected.
+func cleanEntryName(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", &UnsafePathError{Path: name, Reason: "absolute path"}
+	}
+
+	cleaned := filepath.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", &UnsafePathError{Path: name, Reason: "path traverses outside of the container root"}
+	}
+
+	return filepath.Join("/", cleaned), nil
+}
+
+// SecureJoin will join unsafePath to root, resolving every symlink found on the way
+// as if root was the filesystem root, like a chroot would.
+// The returned path is always inside root.
+func SecureJoin(root, unsafePath string) (string, error) {
+	resolved := ""
+	remaining := filepath.Clean("/" + unsafePath)
+	links := 0
+
+	for remaining != "" {
+		var component string
+
+		component, remaining, _ = strings.Cut(strings.TrimPrefix(remaining, "/"), "/")
+
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			// we cannot go above the root
+			resolved = filepath.Dir("/" + resolved)
+			resolved = strings.TrimPrefix(resolved, "/")
+
+			continue
+		}
+
+		next := filepath.Join(resolved, component)
+
+		info, err := os.Lstat(filepath.Join(root, next))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// nothing to resolve anymore, the rest will be created
+				resolved = next
+
+				continue
+			}
+
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+
+			continue
+		}
+
+		links++
+		if links > maxSymlinkDepth {
+			return "", &UnsafePathError{Path: unsafePath, Reason: "too many levels of symbolic links"}
+		}
+
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+
+		// absolute symlinks are relative to the container root
+		if filepath.IsAbs(target) {
+			resolved = ""
+		}
+
+		remaining = target + "/" + remaining
+	}
+
+	return filepath.Join(root, resolved), nil
+}
+
+// resolveEntryPath will return the path on the host where a layer entry, already
+// validated by cleanEntryName, has to be written. Its parent directories are resolved
+// inside root, the last component is never followed, as it will be replaced by the entry.
+func resolveEntryPath(root, cleaned string) (string, error) {
+	if cleaned == "/" {
+		return root, nil
+	}
+
+	dir, base := filepath.Split(cleaned)
+
+	parent, err := SecureJoin(root, dir)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(parent, base), nil
+}
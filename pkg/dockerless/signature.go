@@ -0,0 +1,304 @@
+package dockerless
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// cosignSignatureAnnotation holds the base64 signature of a signature layer
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// maxSignaturePayloadSize is the maximum size of a simple signing payload
+	maxSignaturePayloadSize = 1 << 20
+
+	// LabelSignatureVerified records whether the workspace's image signature was verified
+	LabelSignatureVerified = "dockerless.signature.verified"
+	// LabelSignatureKey records the public key the workspace's image signature was verified with
+	LabelSignatureKey = "dockerless.signature.key"
+)
+
+// SignatureVerification is the result of the signature verification of an image,
+// saved alongside its manifest. The signed digest is either the image's one or
+// the one of the manifest list it belongs to.
+type SignatureVerification struct {
+	ImageDigest  string `json:"imageDigest"`
+	SignedDigest string `json:"signedDigest"`
+	Verified     bool   `json:"verified"`
+	Key          string `json:"key,omitempty"`
+}
+
+// publicKey is a public key signatures are verified with.
+type publicKey struct {
+	path string
+	key  crypto.PublicKey
+}
+
+// simpleSigningPayload is the payload of cosign and containers' simple signing signatures.
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// signatureKeys returns the public keys of the SIGNATURE_PUBLIC_KEYS option.
+// No keys means signatures are not verified.
+func (p *DockerlessProvider) signatureKeys() ([]publicKey, error) {
+	keys := []publicKey{}
+
+	paths := strings.FieldsFunc(p.Config.SignaturePublicKeys, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t'
+	})
+
+	for _, path := range paths {
+		keyBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		block, _ := pem.Decode(keyBytes)
+		if block == nil {
+			return nil, fmt.Errorf("invalid public key %s: no PEM data found", path)
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+		}
+
+		keys = append(keys, publicKey{path: path, key: key})
+	}
+
+	return keys, nil
+}
+
+// verifySignature will look for a cosign signature of the image with input digest, or of
+// the manifest list it belongs to, made with one of input keys. Signatures are stored as the
+// sha256-<digest>.sig tag of the repository, input repo being where the image is pulled from.
+// The signed payload must be a simple signing one, for the digest and input image's repository.
+func (p *DockerlessProvider) verifySignature(
+	ref name.Reference,
+	repo name.Repository,
+	imageDigest v1.Hash,
+	indexDigest v1.Hash,
+	keys []publicKey,
+	remoteOptions []remote.Option,
+) (*SignatureVerification, error) {
+	digests := []v1.Hash{imageDigest}
+	if indexDigest != imageDigest {
+		digests = append(digests, indexDigest)
+	}
+
+	for _, digest := range digests {
+		signatureTag := repo.Tag(fmt.Sprintf("%s-%s.sig", digest.Algorithm, digest.Hex))
+
+		signatureImage, err := remote.Image(signatureTag, remoteOptions...)
+		if err != nil {
+			p.Log.Debugf("no signature found for %s: %v", digest.String(), err)
+
+			continue
+		}
+
+		manifest, err := signatureImage.Manifest()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, layer := range manifest.Layers {
+			signature, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+			if err != nil || len(signature) == 0 {
+				continue
+			}
+
+			payload, err := readSignaturePayload(signatureImage, layer.Digest)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, key := range keys {
+				if !verifyPayload(key.key, payload, signature) {
+					continue
+				}
+
+				err = checkPayload(payload, ref, digest)
+				if err != nil {
+					p.Log.Debugf("signature of %s made with %s does not apply: %v", digest.String(), key.path, err)
+
+					continue
+				}
+
+				return &SignatureVerification{
+					ImageDigest:  imageDigest.String(),
+					SignedDigest: digest.String(),
+					Verified:     true,
+					Key:          key.path,
+				}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no valid signature found for image %s", ref.Name())
+}
+
+// readSignaturePayload returns the content of the signature layer with input digest.
+func readSignaturePayload(signatureImage v1.Image, digest v1.Hash) ([]byte, error) {
+	layer, err := signatureImage.LayerByDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = reader.Close() }()
+
+	return io.ReadAll(io.LimitReader(reader, maxSignaturePayloadSize))
+}
+
+// verifyPayload returns whether signature is a valid signature of payload made with key.
+func verifyPayload(key crypto.PublicKey, payload, signature []byte) bool {
+	hash := sha256.Sum256(payload)
+
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, hash[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil ||
+			rsa.VerifyPSS(key, crypto.SHA256, hash[:], signature, nil) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, payload, signature)
+	default:
+		return false
+	}
+}
+
+// checkPayload returns an error if a simple signing payload does not refer to
+// input image's repository and digest.
+func checkPayload(payload []byte, ref name.Reference, digest v1.Hash) error {
+	simpleSigning := &simpleSigningPayload{}
+
+	err := json.Unmarshal(payload, simpleSigning)
+	if err != nil {
+		return fmt.Errorf("invalid signature payload: %w", err)
+	}
+
+	if simpleSigning.Critical.Image.DockerManifestDigest != digest.String() {
+		return fmt.Errorf("signature is for digest %s", simpleSigning.Critical.Image.DockerManifestDigest)
+	}
+
+	identity, err := name.ParseReference(simpleSigning.Critical.Identity.DockerReference)
+	if err != nil {
+		return fmt.Errorf("invalid signature identity %q: %w", simpleSigning.Critical.Identity.DockerReference, err)
+	}
+
+	if identity.Context().Name() != ref.Context().Name() {
+		return fmt.Errorf("signature is for repository %s", identity.Context().Name())
+	}
+
+	return nil
+}
+
+// readSignatureVerification returns the result of the signature verification
+// of the image stored in imageDir, nil if it was not verified.
+func readSignatureVerification(imageDir string) *SignatureVerification {
+	verificationBytes, err := os.ReadFile(filepath.Join(imageDir, "signature"))
+	if err != nil {
+		return nil
+	}
+
+	verification := &SignatureVerification{}
+
+	err = json.Unmarshal(verificationBytes, verification)
+	if err != nil {
+		return nil
+	}
+
+	return verification
+}
+
+// saveSignatureVerification will save the result of the signature verification of
+// the image stored in imageDir, nil meaning the image was not verified.
+func saveSignatureVerification(imageDir string, verification *SignatureVerification) error {
+	path := filepath.Join(imageDir, "signature")
+
+	if verification == nil {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	verificationBytes, err := json.Marshal(verification)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, verificationBytes, 0o644)
+}
+
+// isVerified returns whether the image stored in imageDir, with input digest,
+// had its signature verified.
+func isVerified(imageDir string, digest v1.Hash) bool {
+	verification := readSignatureVerification(imageDir)
+
+	return verification != nil && verification.Verified && verification.ImageDigest == digest.String()
+}
+
+// isVerifiedWith returns whether the image stored in imageDir, with input digest,
+// had its signature verified with one of input keys.
+func isVerifiedWith(imageDir string, digest v1.Hash, keys []publicKey) bool {
+	if !isVerified(imageDir, digest) {
+		return false
+	}
+
+	verification := readSignatureVerification(imageDir)
+	for _, key := range keys {
+		if key.path == verification.Key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signatureLabels returns the container labels recording the signature
+// verification of the image stored in imageDir, for input digest.
+func signatureLabels(imageDir string, digest v1.Hash) map[string]string {
+	if !isVerified(imageDir, digest) {
+		return map[string]string{LabelSignatureVerified: strconv.FormatBool(false)}
+	}
+
+	verification := readSignatureVerification(imageDir)
+
+	return map[string]string{
+		LabelSignatureVerified: strconv.FormatBool(true),
+		LabelSignatureKey:      verification.Key,
+	}
+}
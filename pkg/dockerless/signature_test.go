@@ -0,0 +1,428 @@
+package dockerless
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/log"
+)
+
+func TestVerifySignature(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []publicKey{
+		{path: "ecdsa.pub", key: &ecdsaKey.PublicKey},
+		{path: "rsa.pub", key: &rsaKey.PublicKey},
+		{path: "ed25519.pub", key: ed25519Key.Public()},
+	}
+
+	imageDigest, err := testImage(t, 0).Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexDigest := testHash(t, "f", 0)
+
+	tests := []struct {
+		name     string
+		signer   crypto.Signer
+		signed   v1.Hash
+		digest   string
+		identity string
+		wantKey  string
+	}{
+		{name: "ecdsa", signer: ecdsaKey, wantKey: "ecdsa.pub"},
+		{name: "rsa", signer: rsaKey, wantKey: "rsa.pub"},
+		{name: "ed25519", signer: ed25519Key, wantKey: "ed25519.pub"},
+		{name: "manifest list", signer: ecdsaKey, signed: indexDigest, wantKey: "ecdsa.pub"},
+		{name: "wrong key", signer: otherKey},
+		{name: "other digest", signer: ecdsaKey, digest: testHash(t, "e", 0).String()},
+		{name: "other repository", signer: ecdsaKey, identity: registry.host() + "/team/other:latest"},
+		{name: "unsigned"},
+	}
+
+	for index, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref, err := name.ParseReference(fmt.Sprintf("%s/team/app-%d:latest", registry.host(), index))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			registry.push(t, ref.Context().Tag("latest"), testImage(t, 0))
+
+			if test.signer != nil {
+				signed := test.signed
+				if signed == (v1.Hash{}) {
+					signed = imageDigest
+				}
+
+				digest, identity := test.digest, test.identity
+				if digest == "" {
+					digest = signed.String()
+				}
+
+				if identity == "" {
+					identity = ref.Name()
+				}
+
+				signatureTag := ref.Context().Tag(fmt.Sprintf("%s-%s.sig", signed.Algorithm, signed.Hex))
+				registry.push(t, signatureTag, testSignatureImage(t, test.signer, identity, digest))
+			}
+
+			provider := &DockerlessProvider{Config: &options.Options{}, Log: log.Discard}
+
+			verification, err := provider.verifySignature(ref, ref.Context(), imageDigest, indexDigest, keys, nil)
+			if test.wantKey == "" {
+				if err == nil {
+					t.Errorf("verifySignature() = %+v, want no valid signature", verification)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("verifySignature() error = %v", err)
+			}
+
+			want := &SignatureVerification{ImageDigest: imageDigest.String(), Verified: true, Key: test.wantKey}
+
+			want.SignedDigest = imageDigest.String()
+			if test.signed != (v1.Hash{}) {
+				want.SignedDigest = test.signed.String()
+			}
+
+			if *verification != *want {
+				t.Errorf("verifySignature() = %+v, want %+v", verification, want)
+			}
+		})
+	}
+}
+
+func TestIsVerifiedWith(t *testing.T) {
+	imageDir := t.TempDir()
+	digest := testHash(t, "a", 0)
+
+	err := saveSignatureVerification(imageDir, &SignatureVerification{
+		ImageDigest:  digest.String(),
+		SignedDigest: digest.String(),
+		Verified:     true,
+		Key:          "/keys/team.pub",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		digest v1.Hash
+		keys   []string
+		want   bool
+	}{
+		{digest: digest, keys: []string{"/keys/team.pub"}, want: true},
+		{digest: digest, keys: []string{"/keys/other.pub", "/keys/team.pub"}, want: true},
+		{digest: digest, keys: []string{"/keys/other.pub"}},
+		{digest: digest},
+		{digest: testHash(t, "b", 0), keys: []string{"/keys/team.pub"}},
+	}
+
+	for _, test := range tests {
+		keys := []publicKey{}
+		for _, key := range test.keys {
+			keys = append(keys, publicKey{path: key})
+		}
+
+		got := isVerifiedWith(imageDir, test.digest, keys)
+		if got != test.want {
+			t.Errorf("isVerifiedWith(%s, %v) = %v, want %v", test.digest.String(), test.keys, got, test.want)
+		}
+	}
+
+	if isVerifiedWith(t.TempDir(), digest, []publicKey{{path: "/keys/team.pub"}}) {
+		t.Errorf("isVerifiedWith() = true for an image never verified")
+	}
+}
+
+func TestPullUnsignedImage(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(t.TempDir(), "key.pub")
+
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keyBytes}), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := name.NewTag(registry.host() + "/team/app:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry.push(t, ref, testImage(t, 0))
+
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir(), PullPolicy: options.PullPolicyMissing, SignaturePublicKeys: keyPath},
+		Log:    log.Discard,
+	}
+
+	err = provider.Pull(context.Background(), &driver.RunOptions{Image: ref.Name()})
+	if err == nil || !strings.Contains(err.Error(), "no valid signature") {
+		t.Errorf("Pull() error = %v, want no valid signature", err)
+	}
+
+	if Exist(provider.ImageDir(ref.Name())) {
+		t.Errorf("Pull() stored an unsigned image")
+	}
+}
+
+// testSignatureImage returns a cosign signature image, signing with input signer a
+// simple signing payload for input identity and digest.
+func testSignatureImage(t *testing.T, signer crypto.Signer, identity, digest string) v1.Image {
+	t.Helper()
+
+	payload := fmt.Sprintf(
+		`{"critical": {"identity": {"docker-reference": %q}, "image": {"docker-manifest-digest": %q}, "type": "cosign container image signature"}}`,
+		identity,
+		digest,
+	)
+
+	hash := sha256.Sum256([]byte(payload))
+
+	var (
+		signature []byte
+		err       error
+	)
+
+	switch signer := signer.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(signer, []byte(payload))
+	default:
+		signature, err = signer.Sign(rand.Reader, hash[:], crypto.SHA256)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloadPath := filepath.Join(t.TempDir(), "payload.json")
+
+	err = os.WriteFile(payloadPath, []byte(payload), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := newFileLayer(payloadPath, "application/vnd.dev.cosign.simplesigning.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       layer,
+		Annotations: map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+// testRegistry is a minimal registry serving the manifests and blobs of the images
+// pushed to it, counting the requests to each of them.
+type testRegistry struct {
+	server    *httptest.Server
+	mutex     sync.Mutex
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	requests  map[string]int
+}
+
+// newTestRegistry returns a registry served on the loopback interface, which is
+// reached with plain http.
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+
+	registry := &testRegistry{
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+		requests:  map[string]int{},
+	}
+
+	registry.server = httptest.NewServer(http.HandlerFunc(registry.serve))
+	t.Cleanup(registry.server.Close)
+
+	return registry
+}
+
+// host returns the host:port of the registry.
+func (r *testRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+// push will make input image available as input tag, and by digest.
+func (r *testRegistry) push(t *testing.T, tag name.Tag, img v1.Image) {
+	t.Helper()
+
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configName, err := img.ConfigName()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	repository := tag.Context().RepositoryStr()
+	r.manifests[repository+"/manifests/"+tag.TagStr()] = rawManifest
+	r.manifests[repository+"/manifests/"+digest.String()] = rawManifest
+	r.blobs[configName.String()] = rawConfig
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, layer := range layers {
+		layerDigest, err := layer.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := layer.Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := io.ReadAll(reader)
+		_ = reader.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.blobs[layerDigest.String()] = content
+	}
+}
+
+// count returns the number of requests to input path, whatever their method.
+func (r *testRegistry) count(path string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	count := 0
+
+	for request, requests := range r.requests {
+		_, requestPath, _ := strings.Cut(request, " ")
+		if requestPath == path {
+			count += requests
+		}
+	}
+
+	return count
+}
+
+func (r *testRegistry) serve(writer http.ResponseWriter, request *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.requests[request.Method+" "+request.URL.Path]++
+
+	path := strings.TrimPrefix(request.URL.Path, "/v2/")
+	if path == "" {
+		return
+	}
+
+	if rawManifest, ok := r.manifests[path]; ok {
+		mediaType := types.DockerManifestSchema2
+		if bytes.Contains(rawManifest, []byte(types.OCIManifestSchema1)) {
+			mediaType = types.OCIManifestSchema1
+		}
+
+		digest, _, _ := v1.SHA256(bytes.NewReader(rawManifest))
+
+		writer.Header().Set("Content-Type", string(mediaType))
+		writer.Header().Set("Docker-Content-Digest", digest.String())
+		http.ServeContent(writer, request, "", time.Time{}, bytes.NewReader(rawManifest))
+
+		return
+	}
+
+	_, digest, ok := strings.Cut(path, "/blobs/")
+	if content, found := r.blobs[digest]; ok && found {
+		writer.Header().Set("Docker-Content-Digest", digest)
+		http.ServeContent(writer, request, "", time.Time{}, bytes.NewReader(content))
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusNotFound)
+}
@@ -0,0 +1,363 @@
+package dockerless
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// snapshotStatusFiles are the files of the workspace's status directory captured by snapshots.
+var snapshotStatusFiles = []string{"runOptions", "containerDetails", "imageDigest", "config.json", "layers"}
+
+// validName matches the workspace ids and snapshot names given on the command line,
+// which are used as directory names.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Snapshot is a saved state of a workspace's rootfs and run options.
+// Snapshots of overlayfs workspaces only hold the workspace's own changes.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Workspace string    `json:"workspace"`
+	Created   time.Time `json:"created"`
+	Overlay   bool      `json:"overlay"`
+}
+
+// checkWorkspaceId returns an error if input workspace id cannot be a directory name.
+func checkWorkspaceId(workspaceId string) error {
+	if !validName.MatchString(workspaceId) {
+		return fmt.Errorf("invalid workspace id %q", workspaceId)
+	}
+
+	return nil
+}
+
+// SnapshotsDir returns the directory holding the snapshots of the workspace with input id.
+func (p *DockerlessProvider) SnapshotsDir(workspaceId string) string {
+	return filepath.Join(p.Config.TargetDir, "snapshots", workspaceId)
+}
+
+// workspaceChanges returns the directory holding the files of the workspace with input id,
+// that is the whole rootfs, or only the overlayfs upper directory.
+func (p *DockerlessProvider) workspaceChanges(workspaceId string) string {
+	if _, overlay := p.workspaceLayers(workspaceId); overlay {
+		return filepath.Join(p.OverlayDir(workspaceId), "upper")
+	}
+
+	return filepath.Join(p.Config.TargetDir, "rootfs", workspaceId)
+}
+
+// CreateSnapshot will save the rootfs and run options of the workspace with input id
+// as a snapshot with input name, empty for one named after the current time.
+// Files are cloned with reflinks when the filesystem supports them.
+func (p *DockerlessProvider) CreateSnapshot(ctx context.Context, workspaceId, name string) (*Snapshot, error) {
+	err := checkWorkspaceId(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	statusDIR := filepath.Join(p.Config.TargetDir, "status", workspaceId)
+
+	if !Exist(filepath.Join(statusDIR, "runOptions")) {
+		return nil, fmt.Errorf("container %s does not exist", workspaceId)
+	}
+
+	if name == "" {
+		name = time.Now().UTC().Format("20060102-150405")
+	}
+
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid snapshot name %q", name)
+	}
+
+	snapshotDIR := filepath.Join(p.SnapshotsDir(workspaceId), name)
+	if Exist(snapshotDIR) {
+		return nil, fmt.Errorf("snapshot %s of %s already exists", name, workspaceId)
+	}
+
+	_, overlay := p.workspaceLayers(workspaceId)
+	snapshot := &Snapshot{
+		Name:      name,
+		Workspace: workspaceId,
+		Created:   time.Now(),
+		Overlay:   overlay,
+	}
+
+	_, err = GetPid(workspaceId)
+	if err == nil {
+		p.Log.Warnf("container %s is running, files being written might be inconsistent", workspaceId)
+	}
+
+	// created aside then renamed, so that partial snapshots are never used
+	tempDir := filepath.Join(p.SnapshotsDir(workspaceId), ".create-"+name)
+
+	err = os.MkdirAll(tempDir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.createSnapshot(workspaceId, tempDir, snapshot)
+	if err == nil {
+		err = os.Rename(tempDir, snapshotDIR)
+	}
+
+	if err != nil {
+		_ = NamespacedCommand("snapshot-"+workspaceId, "rm", "-rf", tempDir).Run()
+
+		return nil, err
+	}
+
+	p.Log.Infof("created snapshot %s of %s", name, workspaceId)
+
+	return snapshot, nil
+}
+
+// createSnapshot will save the workspace with input id in dir.
+func (p *DockerlessProvider) createSnapshot(workspaceId, dir string, snapshot *Snapshot) error {
+	statusDIR := filepath.Join(p.Config.TargetDir, "status", workspaceId)
+
+	err := copyFiles(statusDIR, filepath.Join(dir, "status"), snapshotStatusFiles)
+	if err != nil {
+		return err
+	}
+
+	// the workspace may be running, its namespaces are not reused
+	err = cloneTreeInNamespace("snapshot-"+workspaceId, p.workspaceChanges(workspaceId), filepath.Join(dir, "rootfs"))
+	if err != nil {
+		return err
+	}
+
+	snapshotBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, "snapshot.json"), snapshotBytes, 0o644)
+}
+
+// ListSnapshots returns the snapshots of the workspace with input id, of all the
+// workspaces if empty, sorted by workspace and creation time.
+func (p *DockerlessProvider) ListSnapshots(workspaceId string) ([]Snapshot, error) {
+	workspaces := []string{workspaceId}
+
+	if workspaceId != "" {
+		err := checkWorkspaceId(workspaceId)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		workspaces = []string{}
+
+		entries, err := os.ReadDir(filepath.Join(p.Config.TargetDir, "snapshots"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			workspaces = append(workspaces, entry.Name())
+		}
+	}
+
+	snapshots := []Snapshot{}
+
+	for _, workspace := range workspaces {
+		entries, err := os.ReadDir(p.SnapshotsDir(workspace))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			snapshot, err := p.readSnapshot(workspace, entry.Name())
+			if err != nil {
+				continue
+			}
+
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if snapshots[i].Workspace != snapshots[j].Workspace {
+			return snapshots[i].Workspace < snapshots[j].Workspace
+		}
+
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+
+	return snapshots, nil
+}
+
+// readSnapshot returns the snapshot of the workspace with input id and name.
+func (p *DockerlessProvider) readSnapshot(workspaceId, name string) (*Snapshot, error) {
+	err := checkWorkspaceId(workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid snapshot name %q", name)
+	}
+
+	snapshotBytes, err := os.ReadFile(filepath.Join(p.SnapshotsDir(workspaceId), name, "snapshot.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("snapshot %s of %s not found", name, workspaceId)
+		}
+
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+
+	err = json.Unmarshal(snapshotBytes, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// RestoreSnapshot will roll the workspace with input id back to the snapshot with
+// input name, stopping it first. The snapshot is kept.
+func (p *DockerlessProvider) RestoreSnapshot(ctx context.Context, workspaceId, name string) error {
+	snapshot, err := p.readSnapshot(workspaceId, name)
+	if err != nil {
+		return err
+	}
+
+	snapshotDIR := filepath.Join(p.SnapshotsDir(workspaceId), name)
+	statusDIR := filepath.Join(p.Config.TargetDir, "status", workspaceId)
+
+	if !Exist(filepath.Join(statusDIR, "runOptions")) {
+		return fmt.Errorf("container %s does not exist", workspaceId)
+	}
+
+	if snapshot.Overlay {
+		layers, _ := readLayersFile(filepath.Join(snapshotDIR, "status", "layers"))
+		for _, layer := range layers {
+			if !Exist(p.layerDir(layer)) {
+				return fmt.Errorf("layer %s of snapshot %s is missing", layer.String(), name)
+			}
+		}
+	}
+
+	_, err = GetPid(workspaceId)
+	if err == nil {
+		err = p.Stop(ctx, workspaceId)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.Log.Infof("restoring snapshot %s of %s", name, workspaceId)
+
+	scratchDir, cleanup, err := p.scratchDir(workspaceId, "restore")
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	// the snapshot is cloned aside, the current rootfs is kept if that fails
+	newRootfs := filepath.Join(scratchDir, "rootfs")
+	newOverlay := filepath.Join(scratchDir, "overlay")
+
+	target := newRootfs
+	if snapshot.Overlay {
+		target = filepath.Join(newOverlay, "upper")
+
+		err = os.MkdirAll(filepath.Join(newOverlay, "work"), 0o755)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{newRootfs, target} {
+		err = os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = cloneTreeInNamespace(workspaceId, filepath.Join(snapshotDIR, "rootfs"), target)
+	if err != nil {
+		return err
+	}
+
+	err = p.replaceRootfs(workspaceId, newRootfs, newOverlay)
+	if err != nil {
+		return err
+	}
+
+	// files missing from the snapshot did not exist when it was created
+	for _, file := range snapshotStatusFiles {
+		err = os.Remove(filepath.Join(statusDIR, file))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	err = copyFiles(filepath.Join(snapshotDIR, "status"), statusDIR, snapshotStatusFiles)
+	if err != nil {
+		return err
+	}
+
+	p.Log.Infof("restored snapshot %s of %s", name, workspaceId)
+
+	return nil
+}
+
+// RemoveSnapshot will remove the snapshot of the workspace with input id and name.
+func (p *DockerlessProvider) RemoveSnapshot(workspaceId, name string) error {
+	_, err := p.readSnapshot(workspaceId, name)
+	if err != nil {
+		return err
+	}
+
+	// files belong to the users of the container's user namespace
+	err = NamespacedCommand("snapshot-"+workspaceId, "rm", "-rf", filepath.Join(p.SnapshotsDir(workspaceId), name)).Run()
+	if err != nil {
+		return fmt.Errorf("removing snapshot %s: %w", name, err)
+	}
+
+	// this only succeeds once the workspace has no snapshots left
+	_ = os.Remove(p.SnapshotsDir(workspaceId))
+
+	p.Log.Infof("removed snapshot %s of %s", name, workspaceId)
+
+	return nil
+}
+
+// copyFiles will copy input files from src to dst directory, skipping the missing ones.
+func copyFiles(src, dst string, files []string) error {
+	err := os.MkdirAll(dst, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(src, file))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+
+		err = os.WriteFile(filepath.Join(dst, file), content, 0o644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
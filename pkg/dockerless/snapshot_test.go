@@ -0,0 +1,93 @@
+package dockerless
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+)
+
+func TestReadSnapshotNames(t *testing.T) {
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir()},
+		Log:    log.Discard,
+	}
+
+	err := os.MkdirAll(filepath.Join(provider.SnapshotsDir("workspace"), "snap-1.0"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(provider.SnapshotsDir("workspace"), "snap-1.0", "snapshot.json"), []byte(`{"name": "snap-1.0"}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		workspaceId string
+		name        string
+		wantErr     string
+	}{
+		{workspaceId: "workspace", name: "snap-1.0"},
+		{workspaceId: "workspace", name: "missing", wantErr: "not found"},
+		{workspaceId: "workspace", name: "..", wantErr: "invalid snapshot name"},
+		{workspaceId: "workspace", name: "../../status", wantErr: "invalid snapshot name"},
+		{workspaceId: "workspace", name: ".create-snap", wantErr: "invalid snapshot name"},
+		{workspaceId: "workspace", name: "", wantErr: "invalid snapshot name"},
+		{workspaceId: "..", name: "snap-1.0", wantErr: "invalid workspace id"},
+		{workspaceId: "../..", name: "snap-1.0", wantErr: "invalid workspace id"},
+		{workspaceId: "a/b", name: "snap-1.0", wantErr: "invalid workspace id"},
+		{workspaceId: "", name: "snap-1.0", wantErr: "invalid workspace id"},
+	}
+
+	for _, test := range tests {
+		_, err := provider.readSnapshot(test.workspaceId, test.name)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("readSnapshot(%q, %q) error = %v", test.workspaceId, test.name, err)
+		}
+
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("readSnapshot(%q, %q) error = %v, want %q", test.workspaceId, test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestWorkspaceDigestsSnapshots(t *testing.T) {
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir()},
+		Log:    log.Discard,
+	}
+
+	files := map[string]string{
+		filepath.Join(provider.Config.TargetDir, "status", "workspace", "imageDigest"):              "sha256:rebased",
+		filepath.Join(provider.SnapshotsDir("workspace"), "before-rebase", "status", "imageDigest"): "sha256:original",
+		filepath.Join(provider.SnapshotsDir("workspace"), "before-rebase", "snapshot.json"):         `{"name": "before-rebase", "workspace": "workspace"}`,
+		filepath.Join(provider.SnapshotsDir("deleted"), "kept", "status", "imageDigest"):            "sha256:deleted",
+		filepath.Join(provider.SnapshotsDir("deleted"), "kept", "snapshot.json"):                    `{"name": "kept", "workspace": "deleted"}`,
+	}
+
+	for path, content := range files {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0o644)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	digests, err := provider.WorkspaceDigests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{"sha256:rebased": true, "sha256:original": true, "sha256:deleted": true}
+	if !reflect.DeepEqual(digests, want) {
+		t.Errorf("WorkspaceDigests() = %v, want %v", digests, want)
+	}
+}
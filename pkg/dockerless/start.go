@@ -37,6 +37,12 @@ func (p *DockerlessProvider) Start(ctx context.Context, workspaceId string) erro
 		return err
 	}
 
+	// the policy may have changed since the workspace was created
+	err = p.checkImagePolicy(runOptions.Image)
+	if err != nil {
+		return err
+	}
+
 	// fail early for unsupported options
 	if len(runOptions.SecurityOpt) > 0 {
 		p.Log.Warn("unsupported option by the dockerless driver: SecurityOpt")
@@ -0,0 +1,281 @@
+package dockerless
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"golang.org/x/sys/unix"
+)
+
+// refNameAnnotation is the index.json annotation holding the image reference.
+const refNameAnnotation = "org.opencontainers.image.ref.name"
+
+// StoreDir returns the path of the OCI image layout holding the blobs of every image.
+// Layers are shared between images, as blobs are addressed by their digest.
+func (p *DockerlessProvider) StoreDir() string {
+	return filepath.Join(p.Config.TargetDir, "store")
+}
+
+// BlobPath returns the path of the blob with input digest inside the store.
+func (p *DockerlessProvider) BlobPath(digest v1.Hash) string {
+	return filepath.Join(p.StoreDir(), "blobs", digest.Algorithm, digest.Hex)
+}
+
+// ingestDir returns the directory where blobs are written before being
+// verified and moved into the store.
+func (p *DockerlessProvider) ingestDir() string {
+	return filepath.Join(p.StoreDir(), "ingest")
+}
+
+// openStore will open the image store, initializing an empty OCI image layout
+// if it does not exist yet.
+func (p *DockerlessProvider) openStore() (layout.Path, error) {
+	store, err := layout.FromPath(p.StoreDir())
+	if err == nil {
+		return store, nil
+	}
+
+	return layout.Write(p.StoreDir(), empty.Index)
+}
+
+// LockStore will lock the image store, shared by the pulls adding blobs to it and the
+// workspaces being created from them, exclusive for prune and rmi removing them.
+// The returned function releases the lock.
+func (p *DockerlessProvider) LockStore(exclusive bool) (func(), error) {
+	err := os.MkdirAll(p.StoreDir(), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockFile(filepath.Join(p.StoreDir(), "lock"), exclusive)
+	if err != nil {
+		return nil, fmt.Errorf("locking the image store: %w", err)
+	}
+
+	return unlock, nil
+}
+
+// lockFile will lock the file at input path, created if missing, shared or exclusive.
+// The returned function releases the lock.
+func lockFile(path string, exclusive bool) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+
+	err = unix.Flock(int(file.Fd()), how)
+	if err != nil {
+		_ = file.Close()
+
+		return nil, err
+	}
+
+	// closing the file releases the lock
+	return func() { _ = file.Close() }, nil
+}
+
+// storeImage will write the config and manifest of input image in the store, and
+// point the image reference to it in index.json.
+// Layers are expected to be already in the store.
+func storeImage(store layout.Path, image string, img v1.Image) error {
+	configName, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+
+	err = store.WriteBlob(configName, io.NopCloser(bytes.NewReader(rawConfig)))
+	if err != nil {
+		return err
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+
+	err = store.WriteBlob(digest, io.NopCloser(bytes.NewReader(rawManifest)))
+	if err != nil {
+		return err
+	}
+
+	desc, err := partial.Descriptor(img)
+	if err != nil {
+		return err
+	}
+
+	desc.Annotations = map[string]string{refNameAnnotation: image}
+
+	return updateIndex(store, func(manifests []v1.Descriptor) []v1.Descriptor {
+		return append(untagDescriptors(manifests, image), *desc)
+	})
+}
+
+// untagImage will remove the reference of input image from index.json. The manifests
+// it pointed to are kept as dangling ones, until pruned.
+func untagImage(store layout.Path, image string) error {
+	return updateIndex(store, func(manifests []v1.Descriptor) []v1.Descriptor {
+		return untagDescriptors(manifests, image)
+	})
+}
+
+// untagDescriptors returns input index descriptors, those of input image being
+// turned into dangling ones: workspaces created from them still need them.
+func untagDescriptors(manifests []v1.Descriptor, image string) []v1.Descriptor {
+	untagged := []v1.Descriptor{}
+
+	for _, desc := range manifests {
+		if desc.Annotations[refNameAnnotation] == image {
+			desc.Annotations = nil
+		}
+
+		untagged = append(untagged, desc)
+	}
+
+	return untagged
+}
+
+// updateIndex will replace the descriptors of index.json of input store with the ones
+// returned by update from the current ones. Concurrent updates are serialized with a lock,
+// and dangling descriptors of manifests otherwise referenced are dropped.
+func updateIndex(store layout.Path, update func(manifests []v1.Descriptor) []v1.Descriptor) error {
+	unlock, err := lockFile(filepath.Join(string(store), "index.lock"), true)
+	if err != nil {
+		return fmt.Errorf("locking index.json: %w", err)
+	}
+
+	defer unlock()
+
+	index, err := store.ImageIndex()
+	if err != nil {
+		return err
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	indexManifest.Manifests = compactIndex(update(indexManifest.Manifests))
+
+	rawIndex, err := json.MarshalIndent(indexManifest, "", "   ")
+	if err != nil {
+		return err
+	}
+
+	// replaced at once, index.json is read without the lock
+	indexFile, err := os.CreateTemp(string(store), "index.json-")
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = os.Remove(indexFile.Name()) }()
+
+	_, err = indexFile.Write(rawIndex)
+	if err == nil {
+		err = indexFile.Chmod(0o644)
+	}
+
+	closeErr := indexFile.Close()
+	if err != nil {
+		return err
+	}
+
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return os.Rename(indexFile.Name(), filepath.Join(string(store), "index.json"))
+}
+
+// compactIndex returns input index descriptors without the dangling ones whose
+// manifest is already pointed to by another descriptor.
+func compactIndex(manifests []v1.Descriptor) []v1.Descriptor {
+	referenced := map[v1.Hash]bool{}
+
+	for _, desc := range manifests {
+		if desc.Annotations[refNameAnnotation] != "" {
+			referenced[desc.Digest] = true
+		}
+	}
+
+	compacted := []v1.Descriptor{}
+
+	for _, desc := range manifests {
+		if desc.Annotations[refNameAnnotation] == "" {
+			if referenced[desc.Digest] {
+				continue
+			}
+
+			referenced[desc.Digest] = true
+		}
+
+		compacted = append(compacted, desc)
+	}
+
+	return compacted
+}
+
+// imageDigest returns the digest of the manifest of an image stored in imageDir.
+func imageDigest(imageDir string) (v1.Hash, error) {
+	manifestFile, err := os.Open(filepath.Join(imageDir, "manifest.json"))
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	defer func() { _ = manifestFile.Close() }()
+
+	digest, _, err := v1.SHA256(manifestFile)
+
+	return digest, err
+}
+
+// readImageManifest will read the manifest.json of an image stored in imageDir.
+func readImageManifest(imageDir string) (*v1.Manifest, error) {
+	manifestFile, err := os.ReadFile(filepath.Join(imageDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &v1.Manifest{}
+
+	err = json.Unmarshal(manifestFile, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// hasLayers returns whether all the layers of input manifest are in the store.
+func (p *DockerlessProvider) hasLayers(manifest *v1.Manifest) bool {
+	for _, layer := range manifest.Layers {
+		if !Exist(p.BlobPath(layer.Digest)) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,125 @@
+package dockerless
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestStoreImageConcurrently(t *testing.T) {
+	store, err := layout.Write(t.TempDir(), empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := errgroup.Group{}
+
+	for index := 0; index < 16; index++ {
+		img := testImage(t, index)
+		image := fmt.Sprintf("registry.example.com/app:%d", index)
+
+		group.Go(func() error { return storeImage(store, image, img) })
+	}
+
+	err = group.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no pull dropped the entry of another one
+	got := testIndexManifests(t, store)
+	if len(got) != 16 {
+		t.Errorf("index.json has %d descriptors, want 16: %v", len(got), got)
+	}
+}
+
+func TestStoreImageDangling(t *testing.T) {
+	store, err := layout.Write(t.TempDir(), empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := testImage(t, 0), testImage(t, 1)
+
+	// the tag moves back and forth, and another tag points to the first manifest
+	for _, step := range []struct {
+		image string
+		img   v1.Image
+	}{
+		{"app:latest", first},
+		{"app:latest", second},
+		{"app:latest", first},
+		{"app:latest", second},
+		{"app:latest", second},
+		{"app:v1", first},
+	} {
+		err = storeImage(store, step.image, step.img)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	firstDigest, _ := first.Digest()
+	secondDigest, _ := second.Digest()
+
+	want := map[string]string{secondDigest.String(): "app:latest", firstDigest.String(): "app:v1"}
+
+	got := map[string]string{}
+	for _, desc := range testIndexManifests(t, store) {
+		if _, ok := got[desc.Digest.String()]; ok {
+			t.Errorf("manifest %s is in index.json more than once", desc.Digest.String())
+		}
+
+		got[desc.Digest.String()] = desc.Annotations[refNameAnnotation]
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("index.json = %v, want %v", got, want)
+	}
+
+	// once untagged, the first manifest is kept as a single dangling descriptor
+	err = untagImage(store, "app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifests := testIndexManifests(t, store)
+	if len(manifests) != 2 || manifests[1].Digest != firstDigest || manifests[1].Annotations[refNameAnnotation] != "" {
+		t.Errorf("index.json after untag = %v, want %s dangling", manifests, firstDigest.String())
+	}
+}
+
+// testImage returns an image without layers, distinct for each input index.
+func testImage(t *testing.T, index int) v1.Image {
+	t.Helper()
+
+	img, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{Author: fmt.Sprint(index), OS: "linux", Architecture: runtime.GOARCH})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+// testIndexManifests returns the descriptors of index.json of input store.
+func testIndexManifests(t *testing.T, store layout.Path) []v1.Descriptor {
+	t.Helper()
+
+	index, err := store.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return indexManifest.Manifests
+}
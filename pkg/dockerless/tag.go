@@ -0,0 +1,84 @@
+package dockerless
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TagImage will make target a local alias of the stored source image, replacing
+// the image target referred to if any. The alias shares the source's blobs.
+func (p *DockerlessProvider) TagImage(source, target string) error {
+	if parseImportReference(target) != nil {
+		return fmt.Errorf("cannot tag an image as %s, imported images are named after their source", target)
+	}
+
+	ref, err := localImageName(target)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := p.LockStore(false)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	sourceName := p.storedName(source)
+	targetName := ref.Name()
+
+	img, err := p.StoredImage(source)
+	if err != nil {
+		return err
+	}
+
+	if sourceName == targetName {
+		return nil
+	}
+
+	sourceDIR := p.ImageDir(sourceName)
+	targetDIR := p.ImageDir(targetName)
+
+	err = os.MkdirAll(targetDIR, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range []string{"manifest.json", "config.json"} {
+		content, err := os.ReadFile(filepath.Join(sourceDIR, file))
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(filepath.Join(targetDIR, file), content, 0o644)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the verification is for the digest, which the alias shares
+	err = saveSignatureVerification(targetDIR, readSignatureVerification(sourceDIR))
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(targetDIR, "image_name"), []byte(targetName), 0o644)
+	if err != nil {
+		return err
+	}
+
+	store, err := p.openStore()
+	if err != nil {
+		return err
+	}
+
+	err = storeImage(store, targetName, img)
+	if err != nil {
+		return err
+	}
+
+	p.Log.Infof("tagged %s as %s", sourceName, targetName)
+
+	return nil
+}
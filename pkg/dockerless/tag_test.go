@@ -0,0 +1,51 @@
+package dockerless
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-dockerless/pkg/options"
+	"github.com/loft-sh/log"
+)
+
+func TestTagLocalImage(t *testing.T) {
+	provider := &DockerlessProvider{
+		Config: &options.Options{TargetDir: t.TempDir()},
+		Log:    log.Discard,
+	}
+
+	err := provider.saveImage(context.Background(), "registry.example.com/app:1", testImage(t, 0), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// aliases of aliases, by their unqualified names
+	for _, tag := range [][2]string{
+		{"registry.example.com/app:1", "myimg:v1"},
+		{"myimg:v1", "myimg:v2"},
+		{"myimg:v2", "registry.example.com/app:2"},
+	} {
+		err = provider.TagImage(tag[0], tag[1])
+		if err != nil {
+			t.Fatalf("TagImage(%s, %s) error = %v", tag[0], tag[1], err)
+		}
+	}
+
+	want, err := testImage(t, 0).Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, image := range []string{"dockerless.local/myimg:v1", "dockerless.local/myimg:v2", "registry.example.com/app:2"} {
+		inspect, err := provider.InspectImage(image)
+		if err != nil {
+			t.Errorf("InspectImage(%s) error = %v", image, err)
+
+			continue
+		}
+
+		if inspect.Digest != want.String() {
+			t.Errorf("InspectImage(%s) digest = %s, want %s", image, inspect.Digest, want.String())
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package dockerless
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// whiteoutPrefix marks a file or directory deleted by a layer.
+	whiteoutPrefix = ".wh."
+	// whiteoutOpaqueDir marks a directory whose lower contents are hidden by a layer.
+	whiteoutOpaqueDir = ".wh..wh..opq"
+
+	// overlayXattrPrefix is the namespace of the overlayfs xattrs, mounted with userxattr
+	// in order to work inside user namespaces.
+	overlayXattrPrefix = "user.overlay."
+)
+
+// resolveWhiteout returns the path, resolved inside root, of the file hidden by the
+// whiteout with input cleaned entry name.
+// Whiteouts hiding an empty name, "." or ".." are rejected, as they would
+// delete the parent directory or one above it.
+func resolveWhiteout(root, name string) (string, error) {
+	hidden, ok := hiddenName(filepath.Base(name))
+	if !ok {
+		return "", &UnsafePathError{Path: name, Reason: "invalid whiteout"}
+	}
+
+	return resolveEntryPath(root, filepath.Join(filepath.Dir(name), hidden))
+}
+
+// hiddenName returns the name of the file hidden by the whiteout named base,
+// false if it is not a name inside the whiteout's directory.
+func hiddenName(base string) (string, bool) {
+	hidden := strings.TrimPrefix(base, whiteoutPrefix)
+	if hidden == "" || hidden == "." || hidden == ".." || strings.Contains(hidden, "/") {
+		return "", false
+	}
+
+	return hidden, true
+}
+
+// applyWhiteout will delete the path hidden by a whiteout.
+// path is expected to be already resolved inside the container root, see resolveWhiteout.
+func applyWhiteout(path string) error {
+	return os.RemoveAll(path)
+}
+
+// applyOpaque will empty dir from everything the lower layers put in it,
+// keeping what the current layer already unpacked.
+// dir is expected to be already resolved inside the container root.
+func applyOpaque(dir string, unpacked map[string]struct{}) error {
+	opaqueDir := filepath.Clean(dir)
+
+	err := filepath.WalkDir(opaqueDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if path == opaqueDir {
+			return nil
+		}
+
+		if _, ok := unpacked[path]; ok {
+			return nil
+		}
+
+		err = os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// convertOpaque will mark dir as opaque in the overlayfs format, with the opaque xattr.
+// dir is expected to be already resolved inside the layer directory.
+func convertOpaque(dir string) error {
+	return unix.Setxattr(filepath.Clean(dir), overlayXattrPrefix+"opaque", []byte("y"), 0)
+}
+
+// convertWhiteout will replace the path hidden by a whiteout with an overlayfs
+// whiteout, a 0/0 character device.
+// path is expected to be already resolved inside the layer directory, see resolveWhiteout.
+func convertWhiteout(path string) error {
+	err := os.RemoveAll(path)
+	if err != nil {
+		return err
+	}
+
+	return unix.Mknod(path, unix.S_IFCHR, int(unix.Mkdev(0, 0)))
+}
@@ -0,0 +1,213 @@
+package dockerless
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/loft-sh/log"
+)
+
+func TestCleanEntryName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "usr/bin/sh", want: "/usr/bin/sh"},
+		{name: "./etc/passwd", want: "/etc/passwd"},
+		{name: "etc/../etc/passwd", want: "/etc/passwd"},
+		{name: "./", want: "/"},
+		{name: "dir/..", want: "/"},
+		{name: "/etc/passwd", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: "../etc/passwd", wantErr: true},
+		{name: "dir/../../etc/passwd", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := cleanEntryName(test.name)
+		if test.wantErr {
+			var unsafe *UnsafePathError
+			if !errors.As(err, &unsafe) {
+				t.Errorf("cleanEntryName(%q) error = %v, want an UnsafePathError", test.name, err)
+			}
+
+			continue
+		}
+
+		if err != nil || got != test.want {
+			t.Errorf("cleanEntryName(%q) = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestApplyLayerWhiteouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		removed []string
+		kept    []string
+		wantErr bool
+	}{
+		{
+			name:    "file whiteout",
+			entries: []string{"dir/.wh.file"},
+			removed: []string{"root/dir/file"},
+			kept:    []string{"root/dir", "root/dir/other", "outside"},
+		},
+		{
+			name:    "directory whiteout",
+			entries: []string{".wh.dir"},
+			removed: []string{"root/dir"},
+			kept:    []string{"outside"},
+		},
+		{
+			name:    "opaque directory",
+			entries: []string{"dir/", "dir/new", "dir/.wh..wh..opq"},
+			removed: []string{"root/dir/file", "root/dir/other"},
+			kept:    []string{"root/dir/new", "outside"},
+		},
+		{
+			name:    "dot dot whiteout",
+			entries: []string{".wh..."},
+			kept:    []string{"root", "outside"},
+			wantErr: true,
+		},
+		{
+			name:    "nested dot dot whiteout",
+			entries: []string{"dir/.wh..."},
+			kept:    []string{"root/dir/file", "outside"},
+			wantErr: true,
+		},
+		{
+			name:    "dot whiteout",
+			entries: []string{"dir/.wh.."},
+			kept:    []string{"root/dir/file"},
+			wantErr: true,
+		},
+		{
+			name:    "empty whiteout",
+			entries: []string{"dir/.wh."},
+			kept:    []string{"root/dir/file"},
+			wantErr: true,
+		},
+		{
+			name:    "whiteout through symlink",
+			entries: []string{"link/.wh.outside"},
+			kept:    []string{"outside"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			root := filepath.Join(tempDir, "root")
+
+			for _, file := range []string{"outside", "root/dir/file", "root/dir/other"} {
+				writeTestFile(t, filepath.Join(tempDir, file))
+			}
+
+			// points above the root, it must be resolved inside of it
+			err := os.Symlink("../..", filepath.Join(root, "link"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = ApplyLayer(root, testLayer(t, test.entries), log.Discard)
+			if test.wantErr {
+				var unsafe *UnsafePathError
+				if !errors.As(err, &unsafe) {
+					t.Errorf("ApplyLayer() error = %v, want an UnsafePathError", err)
+				}
+			} else if err != nil {
+				t.Errorf("ApplyLayer() error = %v", err)
+			}
+
+			for _, file := range test.removed {
+				if Exist(filepath.Join(tempDir, file)) {
+					t.Errorf("%s was not removed", file)
+				}
+			}
+
+			for _, file := range test.kept {
+				if !Exist(filepath.Join(tempDir, file)) {
+					t.Errorf("%s was removed", file)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyLayerOverlayWhiteouts(t *testing.T) {
+	for _, entry := range []string{".wh...", "dir/.wh...", "dir/.wh..", "dir/.wh."} {
+		tempDir := t.TempDir()
+		root := filepath.Join(tempDir, "root")
+
+		writeTestFile(t, filepath.Join(root, "dir", "file"))
+
+		err := applyLayer(root, testLayer(t, []string{entry}), true, log.Discard)
+
+		var unsafe *UnsafePathError
+		if !errors.As(err, &unsafe) {
+			t.Errorf("applyLayer(%q) error = %v, want an UnsafePathError", entry, err)
+		}
+
+		if !Exist(filepath.Join(root, "dir", "file")) {
+			t.Errorf("applyLayer(%q) removed dir/file", entry)
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte("content"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testLayer returns an uncompressed layer tarball with input entries, directories
+// ending with a slash, and empty files owned by the current user otherwise.
+func testLayer(t *testing.T, entries []string) *bytes.Buffer {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(buffer)
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Uid:      os.Getuid(),
+			Gid:      os.Getgid(),
+		}
+
+		if entry[len(entry)-1] == '/' {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0o755
+		}
+
+		err := tarWriter.WriteHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := tarWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer
+}
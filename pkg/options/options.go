@@ -3,17 +3,34 @@ package options
 import (
 	"fmt"
 	"os"
+	"strconv"
+)
+
+const (
+	// PullPolicyAlways pulls the image if the remote digest changed
+	PullPolicyAlways = "always"
+	// PullPolicyMissing pulls the image only if it is not stored yet
+	PullPolicyMissing = "missing"
+	// PullPolicyNever never pulls, failing if the image is not stored
+	PullPolicyNever = "never"
 )
 
 type Options struct {
-	DevContainerID string
-	TargetDir      string
+	DevContainerID      string
+	TargetDir           string
+	Platform            string
+	RegistryCredentials string
+	PullConcurrency     int
+	PullPolicy          string
+	SignaturePublicKeys string
 }
 
+// FromEnv returns the options for commands acting on a workspace.
 func FromEnv() (*Options, error) {
-	retOptions := &Options{}
-
-	var err error
+	retOptions, err := GlobalFromEnv()
+	if err != nil {
+		return nil, err
+	}
 
 	// required
 	retOptions.DevContainerID, err = fromEnvOrError("DEVCONTAINER_ID")
@@ -21,12 +38,58 @@ func FromEnv() (*Options, error) {
 		return nil, err
 	}
 
+	return retOptions, nil
+}
+
+// GlobalFromEnv returns the options for commands not bound to a workspace,
+// like the images and registries management ones.
+func GlobalFromEnv() (*Options, error) {
+	retOptions := &Options{}
+
+	var err error
+
 	// required
 	retOptions.TargetDir, err = fromEnvOrError("TARGET_DIR")
 	if err != nil {
 		return nil, err
 	}
 
+	// optional, defaults to the host's platform
+	retOptions.Platform = os.Getenv("PLATFORM")
+
+	// optional, registry=username:password list
+	retOptions.RegistryCredentials = os.Getenv("REGISTRY_CREDENTIALS")
+
+	// optional, number of layers downloaded at the same time
+	retOptions.PullConcurrency = 3
+	if os.Getenv("PULL_CONCURRENCY") != "" {
+		retOptions.PullConcurrency, err = strconv.Atoi(os.Getenv("PULL_CONCURRENCY"))
+		if err != nil || retOptions.PullConcurrency < 1 {
+			return nil, fmt.Errorf("invalid option PULL_CONCURRENCY %q, expected a positive number", os.Getenv("PULL_CONCURRENCY"))
+		}
+	}
+
+	// optional, one of always, missing or never
+	retOptions.PullPolicy = PullPolicyMissing
+	if os.Getenv("PULL_POLICY") != "" {
+		retOptions.PullPolicy = os.Getenv("PULL_POLICY")
+	}
+
+	// optional, paths of the public keys images must be signed with
+	retOptions.SignaturePublicKeys = os.Getenv("SIGNATURE_PUBLIC_KEYS")
+
+	switch retOptions.PullPolicy {
+	case PullPolicyAlways, PullPolicyMissing, PullPolicyNever:
+	default:
+		return nil, fmt.Errorf(
+			"invalid option PULL_POLICY %q, expected one of %s, %s, %s",
+			retOptions.PullPolicy,
+			PullPolicyAlways,
+			PullPolicyMissing,
+			PullPolicyNever,
+		)
+	}
+
 	return retOptions, nil
 }
 